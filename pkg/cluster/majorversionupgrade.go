@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/zalando/postgres-operator/pkg/spec"
@@ -66,7 +67,7 @@ func (c *Cluster) majorVersionUpgrade() error {
 	var masterPod *v1.Pod
 
 	for _, pod := range pods {
-		ps, _ := c.patroni.GetMemberData(&pod)
+		ps, _ := c.patroni.GetMemberData(context.TODO(), &pod)
 
 		if ps.State != "running" {
 			allRunning = false
@@ -399,7 +399,7 @@ func (c *Cluster) isSafeToRecreatePods(pods []v1.Pod) bool {
 		err := retryutil.Retry(1*time.Second, 5*time.Second,
 			func() (bool, error) {
 				var err error
-				data, err = c.patroni.GetMemberData(&pod)
+				data, err = c.patroni.GetMemberData(context.TODO(), &pod)
 
 				if err != nil {
 					return false, err
@@ -396,7 +396,7 @@ func (c *Cluster) syncStatefulSet() error {
 	// Patroni's config endpoint is just a "proxy" to DCS. It is enough to patch it only once and it doesn't matter which pod is used.
 	for i, pod := range pods {
 		podName := util.NameFromMeta(pods[i].ObjectMeta)
-		config, err := c.patroni.GetConfig(&pod)
+		config, err := c.patroni.GetConfig(context.TODO(), &pod)
 		if err != nil {
 			c.logger.Warningf("could not get Postgres config from pod %s: %v", podName, err)
 			continue
@@ -450,10 +450,15 @@ func (c *Cluster) restartInstance(pod *v1.Pod) {
 
 	c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", fmt.Sprintf("restarting Postgres server within %s pod %s", role, pod.Name))
 
-	if err := c.patroni.Restart(pod); err != nil {
+	restarted, err := c.patroni.Restart(context.TODO(), pod)
+	if err != nil {
 		c.logger.Warningf("could not restart Postgres server within %s pod %s: %v", role, podName, err)
 		return
 	}
+	if !restarted {
+		c.logger.Debugf("no pending restart of Postgres server in %s pod %s", role, podName)
+		return
+	}
 
 	c.logger.Debugf("Postgres server successfuly restarted in %s pod %s", role, podName)
 	c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", fmt.Sprintf("Postgres server restart done for %s pod %s", role, pod.Name))
@@ -558,7 +563,7 @@ func (c *Cluster) checkAndSetGlobalPostgreSQLConfiguration(pod *v1.Pod, patroniC
 	podName := util.NameFromMeta(pod.ObjectMeta)
 	c.logger.Debugf("patching Postgres config via Patroni API on pod %s with following options: %s",
 		podName, configToSetJson)
-	if err = c.patroni.SetConfig(pod, configToSet); err != nil {
+	if err = c.patroni.SetConfig(context.TODO(), pod, configToSet); err != nil {
 		return true, fmt.Errorf("could not patch postgres parameters with a pod %s: %v", podName, err)
 	}
 
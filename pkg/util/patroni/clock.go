@@ -0,0 +1,59 @@
+package patroni
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const defaultClockSkewThreshold = 30 * time.Second
+
+// Clock provides the current time, it can be replaced in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// ClockSkewError is returned when the estimated clock skew between operator
+// and node exceeds the threshold
+type ClockSkewError struct {
+	Pod       string
+	Skew      time.Duration
+	Threshold time.Duration
+}
+
+func (e *ClockSkewError) Error() string {
+	return fmt.Sprintf("clock of %s is skewed by %v, more than %v", e.Pod, e.Skew, e.Threshold)
+}
+
+// CheckClockSkew estimates the clock skew between the operator and a node by
+// comparing the time the node last saw the DCS with the operator's clock.
+// The estimate includes up to one HA loop of delay on the node. A positive
+// skew means the node's clock is behind. When it exceeds the threshold the
+// skew is returned together with a ClockSkewError.
+func (p *Patroni) CheckClockSkew(ctx context.Context, server *v1.Pod) (time.Duration, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return 0, err
+	}
+	if data.DCSLastSeen == 0 {
+		return 0, fmt.Errorf("%s does not report dcs_last_seen", server.Name)
+	}
+
+	skew := p.clock.Now().Sub(time.Unix(data.DCSLastSeen, 0))
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs > p.clockSkewThreshold {
+		return skew, &ClockSkewError{Pod: server.Name, Skew: skew, Threshold: p.clockSkewThreshold}
+	}
+	return skew, nil
+}
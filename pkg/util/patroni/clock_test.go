@@ -0,0 +1,68 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeClock returns now, advanced by step with every call if set, so that
+// deadlines pass without sleeping
+type fakeClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	now := time.Date(2021, 2, 19, 14, 31, 50, 0, time.UTC)
+
+	var testTable = []struct {
+		subtest      string
+		lastSeen     time.Time
+		expectedSkew time.Duration
+		expectedErr  bool
+	}{
+		{
+			subtest:      "clocks in sync",
+			lastSeen:     now.Add(-5 * time.Second),
+			expectedSkew: 5 * time.Second,
+		},
+		{
+			subtest:      "node clock behind",
+			lastSeen:     now.Add(-2 * time.Minute),
+			expectedSkew: 2 * time.Minute,
+			expectedErr:  true,
+		},
+		{
+			subtest:      "node clock ahead",
+			lastSeen:     now.Add(time.Minute),
+			expectedSkew: -time.Minute,
+			expectedErr:  true,
+		},
+	}
+	for _, tt := range testTable {
+		body := fmt.Sprintf(`{"state": "running", "role": "replica", "dcs_last_seen": %d}`, tt.lastSeen.Unix())
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, body), nil
+		}}
+		p := New(nil, client, WithClock(&fakeClock{now: now}))
+
+		skew, err := p.CheckClockSkew(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"))
+		if skew != tt.expectedSkew {
+			t.Errorf("%s: expected skew %v, got %v", tt.subtest, tt.expectedSkew, skew)
+		}
+		var skewErr *ClockSkewError
+		if errors.As(err, &skewErr) != tt.expectedErr {
+			t.Errorf("%s: expected clock skew error %t, got %v", tt.subtest, tt.expectedErr, err)
+		}
+	}
+}
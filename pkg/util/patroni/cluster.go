@@ -0,0 +1,177 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ClusterMember is a member as listed by the /cluster endpoint
+type ClusterMember struct {
+	Name     string                 `json:"name"`
+	Role     string                 `json:"role"`
+	State    string                 `json:"state"`
+	Host     string                 `json:"host"`
+	Port     int                    `json:"port"`
+	Tags     map[string]interface{} `json:"tags"`
+	Timeline int                    `json:"timeline"`
+	// Group is the Citus group id, 0 for the coordinator and for clusters
+	// without Citus
+	Group int `json:"group"`
+	// Lag is the replication lag in bytes, or "unknown"
+	Lag interface{} `json:"lag"`
+	// ScheduledSwitchover is set on the leader while a switchover away from
+	// it is scheduled
+	ScheduledSwitchover *ScheduledSwitchover `json:"scheduled_switchover,omitempty"`
+}
+
+// ScheduledSwitchover is a switchover Patroni performs at a later time
+type ScheduledSwitchover struct {
+	At   string `json:"at"`
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+}
+
+// clusterStatus is the response of the /cluster endpoint
+type clusterStatus struct {
+	Members             []ClusterMember      `json:"members"`
+	ScheduledSwitchover *ScheduledSwitchover `json:"scheduled_switchover,omitempty"`
+}
+
+// isLeader tells whether the member holds the leader lock
+func (m ClusterMember) isLeader() bool {
+	return m.Role == "leader" || m.Role == "standby_leader"
+}
+
+// lagBytes returns the replication lag, false if it is unknown
+func (m ClusterMember) lagBytes() (int64, bool) {
+	lag, ok := m.Lag.(float64)
+	return int64(lag), ok
+}
+
+// getCluster reads the view of the whole cluster from any member
+func (p *Patroni) getCluster(ctx context.Context, server *v1.Pod) (clusterStatus, error) {
+	apiURLString, err := p.apiURL(server)
+	if err != nil {
+		return clusterStatus{}, err
+	}
+	body, err := p.httpGet(ctx, apiURLString+clusterPath)
+	if err != nil {
+		return clusterStatus{}, err
+	}
+
+	var cluster clusterStatus
+	if err := json.Unmarshal([]byte(body), &cluster); err != nil {
+		return clusterStatus{}, fmt.Errorf("could not parse cluster status: %v", err)
+	}
+	return cluster, nil
+}
+
+// GetClusterMembers lists all members of the cluster as seen by any of its
+// members. A scheduled switchover is reported on the member it switches
+// over from.
+func (p *Patroni) GetClusterMembers(ctx context.Context, server *v1.Pod) ([]ClusterMember, error) {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	if scheduled := cluster.ScheduledSwitchover; scheduled != nil {
+		for i := range cluster.Members {
+			if cluster.Members[i].Name == scheduled.From {
+				cluster.Members[i].ScheduledSwitchover = scheduled
+			}
+		}
+	}
+	return cluster.Members, nil
+}
+
+// GetClusterMembersByGroup lists the members of a Citus cluster by group
+// id. Asked on the coordinator, Patroni lists the members of all groups,
+// otherwise only those of the group of the member.
+func (p *Patroni) GetClusterMembersByGroup(ctx context.Context, server *v1.Pod) (map[int][]ClusterMember, error) {
+	members, err := p.GetClusterMembers(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[int][]ClusterMember)
+	for _, member := range members {
+		groups[member.Group] = append(groups[member.Group], member)
+	}
+	return groups, nil
+}
+
+// bootstrapStates are the states of a member initializing its data
+// directory or starting Postgres for the first time
+var bootstrapStates = map[string]bool{
+	"initializing new cluster":        true,
+	"running custom bootstrap script": true,
+	"creating replica":                true,
+	"starting":                        true,
+}
+
+// IsBootstrapping tells whether the cluster is still being initialized: no
+// member holds the leader lock yet and the members are bootstrapping or none
+// has registered so far. A member creating a replica while there is a
+// leader does not count, the cluster is initialized then.
+func (p *Patroni) IsBootstrapping(ctx context.Context, server *v1.Pod) (bool, error) {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return false, err
+	}
+
+	bootstrapping := len(cluster.Members) == 0
+	for _, member := range cluster.Members {
+		if member.isLeader() {
+			return false, nil
+		}
+		if bootstrapStates[member.State] {
+			bootstrapping = true
+		}
+	}
+	return bootstrapping, nil
+}
+
+// NonStreamingReplicas returns the sorted names of replicas which recover
+// from the WAL archive only instead of streaming from the primary, which
+// usually means the streaming connection is broken. It relies on Patroni
+// 3.0 and later, which report these as "in archive recovery".
+func (p *Patroni) NonStreamingReplicas(ctx context.Context, server *v1.Pod) ([]string, error) {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, member := range cluster.Members {
+		if !member.isLeader() && member.State == "in archive recovery" {
+			names = append(names, member.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// AllReplicasWithinLag checks the replication lag of every replica against
+// maxBytes and returns the sorted names of the replicas exceeding it.
+// Replicas with unknown lag are counted as exceeding it.
+func (p *Patroni) AllReplicasWithinLag(ctx context.Context, server *v1.Pod, maxBytes int64) (bool, []string, error) {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return false, nil, err
+	}
+
+	violators := []string{}
+	for _, member := range cluster.Members {
+		if member.isLeader() {
+			continue
+		}
+		if lag, ok := member.lagBytes(); !ok || lag > maxBytes {
+			violators = append(violators, member.Name)
+		}
+	}
+	sort.Strings(violators)
+	return len(violators) == 0, violators, nil
+}
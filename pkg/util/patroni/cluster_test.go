@@ -0,0 +1,200 @@
+package patroni
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func newClusterClient(cluster string) *stubHTTPClient {
+	return &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		if request.URL.Path != clusterPath {
+			return newMockResponse(http.StatusNotFound, "not found"), nil
+		}
+		return newMockResponse(http.StatusOK, cluster), nil
+	}}
+}
+
+func TestGetClusterMembers(t *testing.T) {
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running", "host": "10.2.0.4", "port": 5432, "timeline": 6},
+		{"name": "acid-test-1", "role": "replica", "state": "streaming", "host": "10.2.0.5", "port": 5432, "timeline": 6, "lag": 1024}
+	], "scheduled_switchover": {"at": "2021-02-19T15:00:00+00:00", "from": "acid-test-0", "to": "acid-test-1"}}`
+	p := New(testLogger, newClusterClient(cluster))
+
+	members, err := p.GetClusterMembers(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []ClusterMember{
+		{
+			Name:                "acid-test-0",
+			Role:                "leader",
+			State:               "running",
+			Host:                "10.2.0.4",
+			Port:                5432,
+			Timeline:            6,
+			ScheduledSwitchover: &ScheduledSwitchover{At: "2021-02-19T15:00:00+00:00", From: "acid-test-0", To: "acid-test-1"},
+		},
+		{
+			Name:     "acid-test-1",
+			Role:     "replica",
+			State:    "streaming",
+			Host:     "10.2.0.5",
+			Port:     5432,
+			Timeline: 6,
+			Lag:      float64(1024),
+		},
+	}
+	if !reflect.DeepEqual(members, expected) {
+		t.Errorf("expected members %#v, got %#v", expected, members)
+	}
+}
+
+func TestNonStreamingReplicas(t *testing.T) {
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running", "timeline": 6},
+		{"name": "acid-test-1", "role": "replica", "state": "streaming", "timeline": 6, "lag": 0},
+		{"name": "acid-test-2", "role": "replica", "state": "in archive recovery", "timeline": 6, "lag": 16777216},
+		{"name": "acid-test-3", "role": "sync_standby", "state": "streaming", "timeline": 6, "lag": 0}
+	]}`
+	p := New(testLogger, newClusterClient(cluster))
+
+	names, err := p.NonStreamingReplicas(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"acid-test-2"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected non streaming replicas %v, got %v", expected, names)
+	}
+}
+
+func TestAllReplicasWithinLag(t *testing.T) {
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running", "timeline": 6},
+		{"name": "acid-test-1", "role": "replica", "state": "streaming", "timeline": 6, "lag": 1048576},
+		{"name": "acid-test-2", "role": "replica", "state": "streaming", "timeline": 6, "lag": 1048577},
+		{"name": "acid-test-3", "role": "sync_standby", "state": "streaming", "timeline": 6, "lag": 0},
+		{"name": "acid-test-4", "role": "replica", "state": "stopped", "lag": "unknown"}
+	]}`
+	p := New(testLogger, newClusterClient(cluster))
+
+	var testTable = []struct {
+		subtest           string
+		maxBytes          int64
+		expectedWithin    bool
+		expectedViolators []string
+	}{
+		{
+			subtest:           "replicas straddling the threshold",
+			maxBytes:          1048576,
+			expectedWithin:    false,
+			expectedViolators: []string{"acid-test-2", "acid-test-4"},
+		},
+		{
+			subtest:           "threshold above all known lags",
+			maxBytes:          16777216,
+			expectedWithin:    false,
+			expectedViolators: []string{"acid-test-4"},
+		},
+	}
+	for _, tt := range testTable {
+		within, violators, err := p.AllReplicasWithinLag(context.Background(), newMockPod("192.168.100.1"), tt.maxBytes)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if within != tt.expectedWithin || !reflect.DeepEqual(violators, tt.expectedViolators) {
+			t.Errorf("%s: expected %v with violators %v, got %v with %v", tt.subtest, tt.expectedWithin, tt.expectedViolators, within, violators)
+		}
+	}
+
+	healthy := `{"members": [{"name": "acid-test-0", "role": "leader"}, {"name": "acid-test-1", "role": "replica", "lag": 0}]}`
+	within, violators, err := New(testLogger, newClusterClient(healthy)).AllReplicasWithinLag(context.Background(), newMockPod("192.168.100.1"), 0)
+	if err != nil || !within || len(violators) != 0 {
+		t.Errorf("expected all replicas within lag, got %v with %v and error %v", within, violators, err)
+	}
+}
+
+func TestGetClusterMembersByGroup(t *testing.T) {
+	cluster := `{"members": [
+		{"name": "acid-citus-0", "role": "leader", "state": "running", "timeline": 1, "group": 0},
+		{"name": "acid-citus-worker-1-0", "role": "leader", "state": "running", "timeline": 1, "group": 1},
+		{"name": "acid-citus-worker-1-1", "role": "replica", "state": "streaming", "timeline": 1, "lag": 0, "group": 1}
+	]}`
+	p := New(testLogger, newClusterClient(cluster))
+
+	groups, err := p.GetClusterMembersByGroup(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := make(map[int][]string)
+	for group, members := range groups {
+		for _, member := range members {
+			names[group] = append(names[group], member.Name)
+		}
+	}
+	expected := map[int][]string{
+		0: {"acid-citus-0"},
+		1: {"acid-citus-worker-1-0", "acid-citus-worker-1-1"},
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected members by group %v, got %v", expected, names)
+	}
+}
+
+func TestIsBootstrapping(t *testing.T) {
+	var testTable = []struct {
+		subtest  string
+		cluster  string
+		expected bool
+	}{
+		{
+			subtest:  "no member registered",
+			cluster:  `{"members": []}`,
+			expected: true,
+		},
+		{
+			subtest: "initializing new cluster",
+			cluster: `{"members": [
+				{"name": "acid-test-0", "role": "replica", "state": "initializing new cluster"},
+				{"name": "acid-test-1", "role": "replica", "state": "stopped"}
+			]}`,
+			expected: true,
+		},
+		{
+			subtest: "leader starting",
+			cluster: `{"members": [
+				{"name": "acid-test-0", "role": "replica", "state": "starting"}
+			]}`,
+			expected: true,
+		},
+		{
+			subtest: "replica created in initialized cluster",
+			cluster: `{"members": [
+				{"name": "acid-test-0", "role": "leader", "state": "running", "timeline": 1},
+				{"name": "acid-test-1", "role": "replica", "state": "creating replica"}
+			]}`,
+			expected: false,
+		},
+		{
+			subtest: "leaderless after bootstrap",
+			cluster: `{"members": [
+				{"name": "acid-test-0", "role": "replica", "state": "stopped", "timeline": 3},
+				{"name": "acid-test-1", "role": "replica", "state": "stopped", "timeline": 3}
+			]}`,
+			expected: false,
+		},
+	}
+	for _, tt := range testTable {
+		p := New(testLogger, newClusterClient(tt.cluster))
+
+		bootstrapping, err := p.IsBootstrapping(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if bootstrapping != tt.expected {
+			t.Errorf("%s: expected bootstrapping %t, got %t", tt.subtest, tt.expected, bootstrapping)
+		}
+	}
+}
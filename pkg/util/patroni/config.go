@@ -0,0 +1,625 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultApplyTimeout = time.Minute
+	defaultDCSNamespace = "/service/"
+)
+
+// PostgresInfo describes the Postgres instance managed by a Patroni member.
+// The data directory is not part of it, as it is only set in the local
+// configuration of the member, which the API does not expose.
+type PostgresInfo struct {
+	Version          string
+	SystemIdentifier string
+	Port             int
+}
+
+// lookupConfig walks nested config sections and returns the value at path
+func lookupConfig(config map[string]interface{}, path ...string) (interface{}, bool) {
+	var value interface{} = config
+	for _, key := range path {
+		section, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = section[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// formatServerVersion turns the numeric server_version into its text form,
+// e.g. 90621 into 9.6.21 and 130002 into 13.2
+func formatServerVersion(version int) string {
+	if version >= 100000 {
+		return fmt.Sprintf("%d.%d", version/10000, version%10000)
+	}
+	return fmt.Sprintf("%d.%d.%d", version/10000, version/100%100, version%100)
+}
+
+// GetPostgresInfo reads version and identity of the Postgres instance from
+// the member status, complemented by the port the member is listed with in
+// the cluster view
+func (p *Patroni) GetPostgresInfo(ctx context.Context, server *v1.Pod) (PostgresInfo, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return PostgresInfo{}, err
+	}
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return PostgresInfo{}, err
+	}
+
+	for _, member := range cluster.Members {
+		if member.Name != server.Name {
+			continue
+		}
+		if member.Port == 0 {
+			return PostgresInfo{}, fmt.Errorf("cluster of %s reports no port for it", server.Name)
+		}
+		return PostgresInfo{
+			Version:          formatServerVersion(data.ServerVersion),
+			SystemIdentifier: data.SystemID,
+			Port:             member.Port,
+		}, nil
+	}
+	return PostgresInfo{}, fmt.Errorf("%s is not a member of its cluster", server.Name)
+}
+
+// defaultPrimaryStartTimeout is Patroni's default for primary_start_timeout
+const defaultPrimaryStartTimeout = 300 * time.Second
+
+// configSeconds interprets a config value given in seconds as duration
+func configSeconds(value interface{}) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(fmt.Sprintf("%v", value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %v as seconds: %v", value, err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// GetPrimaryStartTimeout reads primary_start_timeout, falling back to the
+// master_start_timeout key used by Patroni versions before 2.1.0
+func (p *Patroni) GetPrimaryStartTimeout(ctx context.Context, server *v1.Pod) (time.Duration, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range []string{"primary_start_timeout", "master_start_timeout"} {
+		if value, ok := config[key]; ok {
+			return configSeconds(value)
+		}
+	}
+	return defaultPrimaryStartTimeout, nil
+}
+
+// SetPrimaryStartTimeout sets primary_start_timeout, rounded to seconds
+func (p *Patroni) SetPrimaryStartTimeout(ctx context.Context, server *v1.Pod, timeout time.Duration) error {
+	return p.SetConfig(ctx, server, map[string]interface{}{"primary_start_timeout": int(timeout.Round(time.Second) / time.Second)})
+}
+
+// GetDCSNamespace returns the namespace prefixing the DCS keys of the
+// cluster, Patroni's default if it is not configured
+func (p *Patroni) GetDCSNamespace(ctx context.Context, server *v1.Pod) (string, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return "", err
+	}
+	value, ok := config["namespace"]
+	if !ok {
+		return defaultDCSNamespace, nil
+	}
+	namespace, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("namespace of %s is not a string: %v", server.Name, value)
+	}
+	return namespace, nil
+}
+
+// GetFlattenedConfig returns the config with nested keys flattened into
+// dotted paths, e.g. postgresql.parameters.max_connections. Array elements
+// get indexed keys like pg_hba[0].
+func (p *Patroni) GetFlattenedConfig(ctx context.Context, server *v1.Pod) (map[string]interface{}, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	flattened := make(map[string]interface{})
+	flattenConfig("", config, flattened)
+	return flattened, nil
+}
+
+// GetFlattenedConfigs reads the flattened config of all given pods, keyed by
+// pod name. Pods that could not be queried are reported in the returned
+// error map.
+func (p *Patroni) GetFlattenedConfigs(ctx context.Context, servers []*v1.Pod) (map[string]map[string]interface{}, map[string]error) {
+	configs := make(map[string]map[string]interface{}, len(servers))
+	errs := make(map[string]error)
+	for _, server := range servers {
+		config, err := p.GetFlattenedConfig(ctx, server)
+		if err != nil {
+			errs[server.Name] = err
+			continue
+		}
+		configs[server.Name] = config
+	}
+	return configs, errs
+}
+
+// ConfigDrift compares the config as seen by every pod and returns the
+// flattened keys whose values differ, with the value per pod name. The
+// /config endpoint serves the cluster-wide dynamic configuration from the
+// DCS, not the effective settings of the node, so a drift only reveals a
+// member with a stale copy of it, e.g. one cut off from the DCS. Pods
+// lacking a key are listed with a nil value. Pods that could not be queried
+// are left out of the comparison and reported in the error.
+func (p *Patroni) ConfigDrift(ctx context.Context, servers []*v1.Pod) (map[string]map[string]interface{}, error) {
+	configs, errs := p.GetFlattenedConfigs(ctx, servers)
+
+	keys := make(map[string]bool)
+	for _, config := range configs {
+		for key := range config {
+			keys[key] = true
+		}
+	}
+	drift := make(map[string]map[string]interface{})
+	for key := range keys {
+		values := make(map[string]interface{}, len(configs))
+		uniform := true
+		var first interface{}
+		seen := false
+		for name, config := range configs {
+			value := config[key]
+			values[name] = value
+			if !seen {
+				first, seen = value, true
+			} else if !reflect.DeepEqual(first, value) {
+				uniform = false
+			}
+		}
+		if !uniform {
+			drift[key] = values
+		}
+	}
+	return drift, membersError(errs)
+}
+
+// flattenConfig adds all leaves of value to result, empty maps and arrays are
+// kept as leaves so that they do not get lost
+func flattenConfig(prefix string, value interface{}, result map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			result[prefix] = v
+		}
+		for key, item := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenConfig(key, item, result)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			result[prefix] = v
+		}
+		for i, item := range v {
+			flattenConfig(fmt.Sprintf("%s[%d]", prefix, i), item, result)
+		}
+	default:
+		result[prefix] = value
+	}
+}
+
+// DynamicConfig is the typed part of the dynamic configuration, use
+// GetConfig for keys not covered here. Timings are in seconds, zero values
+// mean the key is not set.
+type DynamicConfig struct {
+	TTL                  int   `json:"ttl"`
+	LoopWait             int   `json:"loop_wait"`
+	RetryTimeout         int   `json:"retry_timeout"`
+	MaximumLagOnFailover int64 `json:"maximum_lag_on_failover"`
+	Pause                bool  `json:"pause"`
+	// Parameters are the Postgres parameters, with values formatted as
+	// strings regardless of their JSON type
+	Parameters map[string]string `json:"-"`
+}
+
+// GetDynamicConfig reads the dynamic configuration into a DynamicConfig
+func (p *Patroni) GetDynamicConfig(ctx context.Context, server *v1.Pod) (DynamicConfig, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return DynamicConfig{}, err
+	}
+
+	var dynamic DynamicConfig
+	if err := decodeConfigSection(config, &dynamic); err != nil {
+		return DynamicConfig{}, fmt.Errorf("could not parse config of %s: %v", server.Name, err)
+	}
+	dynamic.Parameters = make(map[string]string)
+	if section, ok := lookupConfig(config, "postgresql", "parameters"); ok {
+		parameters, ok := section.(map[string]interface{})
+		if !ok {
+			return DynamicConfig{}, fmt.Errorf("could not parse config of %s: parameters are %T", server.Name, section)
+		}
+		for name, value := range parameters {
+			dynamic.Parameters[name] = fmt.Sprintf("%v", value)
+		}
+	}
+	return dynamic, nil
+}
+
+// managedParameters are set by Patroni itself, from the local config of the
+// member or its role, and override the dynamic configuration. The standby
+// names are only managed in synchronous mode.
+var managedParameters = []string{
+	"cluster_name",
+	"hot_standby",
+	"listen_addresses",
+	"port",
+	"primary_conninfo",
+	"primary_slot_name",
+	"recovery_target_timeline",
+	"synchronous_standby_names",
+}
+
+// isManagedParameter tells whether Patroni sets the parameter itself
+func isManagedParameter(name string) bool {
+	for _, managed := range managedParameters {
+		if name == managed {
+			return true
+		}
+	}
+	return false
+}
+
+// ManagedParameters returns the parameters Patroni sets itself, mapped to
+// the value the dynamic configuration sets for them, or nil if it does not.
+// Patroni does not report these parameters, so they are the ones known to be
+// managed by Patroni; values in the dynamic configuration have no effect.
+func (p *Patroni) ManagedParameters(ctx context.Context, server *v1.Pod) (map[string]interface{}, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	managed := make(map[string]interface{}, len(managedParameters))
+	for _, name := range managedParameters {
+		value, _ := lookupConfig(config, "postgresql", "parameters", name)
+		managed[name] = value
+	}
+	return managed, nil
+}
+
+// WatchdogConfig is the watchdog section of the local Patroni config
+type WatchdogConfig struct {
+	Mode         string `json:"mode"`
+	Device       string `json:"device"`
+	SafetyMargin int    `json:"safety_margin"`
+}
+
+// decodeConfigSection converts a section of the generic config into a struct
+func decodeConfigSection(section interface{}, result interface{}) error {
+	content, err := json.Marshal(section)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, result)
+}
+
+// GetWatchdogConfig would read the watchdog settings of the member. The
+// watchdog is only configured in the local configuration of each member,
+// which the API does not expose, and /config never has a watchdog section.
+// So it always returns ErrNotSupported without querying the member, rather
+// than reporting a member as unfenced.
+func (p *Patroni) GetWatchdogConfig(ctx context.Context, server *v1.Pod) (WatchdogConfig, error) {
+	return WatchdogConfig{}, fmt.Errorf("could not get the watchdog config of %s: %w", server.Name, ErrNotSupported)
+}
+
+// VerifyParametersApplied waits until the member applied the expected
+// Postgres parameters: they have to be stored in the dynamic configuration
+// and the member must not report a pending restart for them. Parameters only
+// requiring a reload are not reported by Patroni, it applies them within one
+// loop_wait, so it waits at least that long. On timeout it returns false with
+// the sorted names of the parameters which are not applied yet.
+func (p *Patroni) VerifyParametersApplied(ctx context.Context, server *v1.Pod, expected map[string]string) (bool, []string, error) {
+	start := p.clock.Now()
+	deadline := start.Add(p.applyTimeout)
+	for {
+		config, err := p.GetConfig(ctx, server)
+		if err != nil {
+			return false, nil, err
+		}
+		loopWait := defaultLoopWait
+		if value, ok := config["loop_wait"]; ok {
+			if loopWait, err = configSeconds(value); err != nil {
+				return false, nil, fmt.Errorf("could not parse loop_wait: %v", err)
+			}
+		}
+		data, err := p.GetMemberData(ctx, server)
+		if err != nil {
+			return false, nil, err
+		}
+
+		unapplied := unappliedParameters(config, data, expected)
+		now := p.clock.Now()
+		if len(unapplied) == 0 && (!now.Before(start.Add(loopWait)) || now.After(deadline)) {
+			return true, nil, nil
+		}
+		if now.After(deadline) {
+			return false, unapplied, nil
+		}
+		if err := sleep(ctx, p.pollInterval); err != nil {
+			return false, unapplied, err
+		}
+	}
+}
+
+// unappliedParameters returns the sorted names of the expected parameters
+// which are not stored in the config or wait for a restart of the member.
+// Patroni versions before 3.0.4 do not tell which parameters need the
+// restart, so all are taken as unapplied then.
+func unappliedParameters(config map[string]interface{}, data MemberData, expected map[string]string) []string {
+	unapplied := make(map[string]bool)
+	for _, name := range mismatchedParameters(config, expected) {
+		unapplied[name] = true
+	}
+	if data.PendingRestart {
+		for name := range expected {
+			if _, ok := data.PendingRestartReason[name]; ok || data.PendingRestartReason == nil {
+				unapplied[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(unapplied))
+	for name := range unapplied {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReplicationReady checks the Postgres parameters replicas depend on:
+// wal_level must be at least replica and max_wal_senders positive. These are
+// the values configured in the dynamic configuration, not the effective ones
+// of the running Postgres. Parameters which are not configured have the
+// Patroni default, which allows replication. hot_standby is not checked, as
+// Patroni sets it itself and ignores a configured value. If a prerequisite
+// is missing, the reason describes it.
+func (p *Patroni) ReplicationReady(ctx context.Context, server *v1.Pod) (bool, string, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return false, "", err
+	}
+	parameter := func(name string) (string, bool) {
+		value, ok := lookupConfig(config, "postgresql", "parameters", name)
+		return strings.ToLower(fmt.Sprintf("%v", value)), ok
+	}
+
+	if level, ok := parameter("wal_level"); ok && level != "replica" && level != "logical" && level != "hot_standby" {
+		return false, fmt.Sprintf("wal_level is %q, but at least replica is required", level), nil
+	}
+	if senders, ok := parameter("max_wal_senders"); ok {
+		if n, err := strconv.Atoi(senders); err != nil || n <= 0 {
+			return false, fmt.Sprintf("max_wal_senders is %q, but must be positive", senders), nil
+		}
+	}
+	return true, "", nil
+}
+
+// parametersPrefix is the dotted path of the Postgres parameters, whose
+// names may contain dots themselves, e.g. pg_stat_statements.max
+const parametersPrefix = "postgresql.parameters."
+
+// splitConfigKey splits a dotted config key into its path, keeping the name
+// of a Postgres parameter as a whole
+func splitConfigKey(key string) []string {
+	if strings.HasPrefix(key, parametersPrefix) {
+		return []string{"postgresql", "parameters", strings.TrimPrefix(key, parametersPrefix)}
+	}
+	return strings.Split(key, ".")
+}
+
+// DeleteConfigKeys removes keys from the dynamic configuration, so they fall
+// back to Patroni's defaults. Nested keys are given as dotted paths, e.g.
+// postgresql.parameters.work_mem, where everything after
+// postgresql.parameters. is the name of a parameter. Deleting a key deletes
+// all keys below it.
+func (p *Patroni) DeleteConfigKeys(ctx context.Context, server *v1.Pod, keys []string) error {
+	patch := make(map[string]interface{})
+	for _, key := range keys {
+		parts := splitConfigKey(key)
+		section := patch
+		for i, part := range parts {
+			if part == "" {
+				return fmt.Errorf("invalid config key %q", key)
+			}
+			if i == len(parts)-1 {
+				section[part] = nil
+				break
+			}
+			child, ok := section[part].(map[string]interface{})
+			if !ok {
+				if _, deleted := section[part]; deleted {
+					// a parent of the key is deleted already
+					break
+				}
+				child = make(map[string]interface{})
+				section[part] = child
+			}
+			section = child
+		}
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+	return p.SetConfig(ctx, server, patch)
+}
+
+// ConfigSyncStatus would compare the config version applied by the member
+// with the one stored in the DCS. Patroni reports no version of the dynamic
+// configuration, neither in the status nor in /config, so it always returns
+// ErrNotSupported without querying the member. Use VerifyParametersApplied to
+// wait for a change to take effect instead.
+func (p *Patroni) ConfigSyncStatus(ctx context.Context, server *v1.Pod) (applied string, pending string, inSync bool, err error) {
+	return "", "", false, fmt.Errorf("could not compare the config versions of %s: %w", server.Name, ErrNotSupported)
+}
+
+// SetParameterWithOverrides sets a Postgres parameter to defaultValue, or to
+// the override for pods named in overrides, and returns the errors keyed by
+// pod name. The dynamic configuration is shared by all members though, so
+// Patroni cannot apply different values per member: if the values differ,
+// nothing is sent and every pod is reported with ErrNotSupported, per member
+// values belong into the local Patroni configuration. Otherwise the value is
+// set through the first pod accepting it, as any member can carry the change.
+func (p *Patroni) SetParameterWithOverrides(ctx context.Context, servers []*v1.Pod, key string, defaultValue interface{}, overrides map[string]interface{}) map[string]error {
+	errs := make(map[string]error)
+	value := defaultValue
+	for i, server := range servers {
+		podValue, ok := overrides[server.Name]
+		if !ok {
+			podValue = defaultValue
+		}
+		if i == 0 {
+			value = podValue
+		} else if !reflect.DeepEqual(podValue, value) {
+			for _, server := range servers {
+				errs[server.Name] = fmt.Errorf("could not set %s per member: %w", key, ErrNotSupported)
+			}
+			return errs
+		}
+	}
+
+	patch := map[string]interface{}{"postgresql": map[string]interface{}{"parameters": map[string]interface{}{key: value}}}
+	for _, server := range servers {
+		err := p.SetConfig(ctx, server, patch)
+		if err == nil {
+			return map[string]error{}
+		}
+		errs[server.Name] = err
+	}
+	return errs
+}
+
+// ConfigSections are parts of the dynamic configuration which are changed
+// together by SetConfigSections. Nil sections are left unchanged.
+type ConfigSections struct {
+	Parameters map[string]string
+	Slots      map[string]SlotConfig
+	Timings    *Timings
+	Pause      *bool
+}
+
+// validate checks the invariants of the sections which are set
+func (s ConfigSections) validate() error {
+	if s.Timings != nil {
+		if err := s.Timings.Validate(); err != nil {
+			return err
+		}
+	}
+	for name, slot := range s.Slots {
+		switch slot.Type {
+		case "physical":
+		case "logical":
+			if slot.Database == "" || slot.Plugin == "" {
+				return fmt.Errorf("logical slot %s needs a database and a plugin", name)
+			}
+		default:
+			return fmt.Errorf("slot %s has unknown type %q", name, slot.Type)
+		}
+	}
+	return nil
+}
+
+// SetConfigSections changes all given sections with a single PATCH, so they
+// are applied together in one new config version. The sections are
+// validated before anything is sent.
+func (p *Patroni) SetConfigSections(ctx context.Context, server *v1.Pod, sections ConfigSections) error {
+	if err := sections.validate(); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	patch := make(map[string]interface{})
+	if sections.Parameters != nil {
+		patch["postgresql"] = map[string]interface{}{"parameters": sections.Parameters}
+	}
+	if sections.Slots != nil {
+		patch["slots"] = sections.Slots
+	}
+	if t := sections.Timings; t != nil {
+		patch["ttl"] = int(t.TTL / time.Second)
+		patch["loop_wait"] = int(t.LoopWait / time.Second)
+		patch["retry_timeout"] = int(t.RetryTimeout / time.Second)
+	}
+	if sections.Pause != nil {
+		patch["pause"] = *sections.Pause
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+	return p.SetConfig(ctx, server, patch)
+}
+
+// mismatchedParameters returns the sorted names of parameters whose value in
+// config differs from the expected one
+func mismatchedParameters(config map[string]interface{}, expected map[string]string) []string {
+	var mismatched []string
+	for name, value := range expected {
+		actual, ok := lookupConfig(config, "postgresql", "parameters", name)
+		if !ok || fmt.Sprintf("%v", actual) != value {
+			mismatched = append(mismatched, name)
+		}
+	}
+	sort.Strings(mismatched)
+	return mismatched
+}
+
+// checkMutableKeys rejects a config patch touching keys outside of the
+// allow-list, if there is one. An allowed key also allows all keys below it.
+func (p *Patroni) checkMutableKeys(patch map[string]interface{}) error {
+	if p.mutableKeys == nil {
+		return nil
+	}
+	// typed sections like map[string]string are only flattened after they
+	// were converted to the types of decoded JSON
+	normalized, err := normalizeJSON(patch)
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	flattened := make(map[string]interface{})
+	flattenConfig("", normalized, flattened)
+
+	var rejected []string
+	for key := range flattened {
+		if !p.isMutableKey(key) {
+			rejected = append(rejected, key)
+		}
+	}
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		return fmt.Errorf("config keys are not allowed to be changed: %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+func (p *Patroni) isMutableKey(key string) bool {
+	for _, allowed := range p.mutableKeys {
+		if key == allowed || strings.HasPrefix(key, allowed+".") || strings.HasPrefix(key, allowed+"[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,718 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetPostgresInfo(t *testing.T) {
+	status := `{"state": "running", "role": "master", "server_version": 130002, "database_system_identifier": "6462555844314089962", "patroni": {"version": "2.0.1", "scope": "acid-test"}}`
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running", "host": "10.0.0.1", "port": 5433},
+		{"name": "acid-test-1", "role": "replica", "state": "running", "host": "10.0.0.2"}
+	]}`
+
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		if request.URL.Path == clusterPath {
+			return newMockResponse(http.StatusOK, cluster), nil
+		}
+		return newMockResponse(http.StatusOK, status), nil
+	}}
+	p := New(testLogger, client)
+
+	info, err := p.GetPostgresInfo(context.Background(), newMockNamedPod("acid-test-0", "10.0.0.1"))
+	if err != nil {
+		t.Fatalf("could not get Postgres info: %v", err)
+	}
+	expected := PostgresInfo{
+		Version:          "13.2",
+		SystemIdentifier: "6462555844314089962",
+		Port:             5433,
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %#v, got %#v", expected, info)
+	}
+
+	for _, name := range []string{"acid-test-1", "acid-test-9"} {
+		if _, err := p.GetPostgresInfo(context.Background(), newMockNamedPod(name, "10.0.0.2")); err == nil {
+			t.Errorf("expected an error for %s without port", name)
+		}
+	}
+}
+
+func TestFormatServerVersion(t *testing.T) {
+	var testTable = []struct {
+		version  int
+		expected string
+	}{
+		{90621, "9.6.21"},
+		{100016, "10.16"},
+		{130002, "13.2"},
+	}
+	for _, tt := range testTable {
+		if result := formatServerVersion(tt.version); result != tt.expected {
+			t.Errorf("expected version %d to be formatted as %s, got %s", tt.version, tt.expected, result)
+		}
+	}
+}
+
+func TestGetPrimaryStartTimeout(t *testing.T) {
+	var testTable = []struct {
+		subtest  string
+		config   string
+		expected time.Duration
+	}{
+		{
+			subtest:  "current key",
+			config:   `{"ttl": 30, "primary_start_timeout": 120}`,
+			expected: 120 * time.Second,
+		},
+		{
+			subtest:  "legacy key",
+			config:   `{"ttl": 30, "master_start_timeout": 60}`,
+			expected: 60 * time.Second,
+		},
+		{
+			subtest:  "default",
+			config:   `{"ttl": 30}`,
+			expected: 300 * time.Second,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.config), nil
+		}}
+		p := New(testLogger, client)
+
+		timeout, err := p.GetPrimaryStartTimeout(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if timeout != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.subtest, tt.expected, timeout)
+		}
+	}
+}
+
+func TestSetPrimaryStartTimeout(t *testing.T) {
+	var body string
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		content, err := ioutil.ReadAll(request.Body)
+		body = string(content)
+		return newMockResponse(http.StatusOK, "{}"), err
+	}}
+	p := New(testLogger, client)
+
+	if err := p.SetPrimaryStartTimeout(context.Background(), newMockPod("192.168.100.1"), 2*time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "{\"primary_start_timeout\":120}\n"; body != expected {
+		t.Errorf("expected body %q, got %q", expected, body)
+	}
+
+	if err := p.SetPrimaryStartTimeout(context.Background(), newMockPod("192.168.100.1"), 1900*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "{\"primary_start_timeout\":2}\n"; body != expected {
+		t.Errorf("expected body %q, got %q", expected, body)
+	}
+}
+
+func TestGetDCSNamespace(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		config        string
+		expected      string
+		expectedError bool
+	}{
+		{
+			subtest:  "custom namespace",
+			config:   `{"ttl": 30, "namespace": "/tenant-a/"}`,
+			expected: "/tenant-a/",
+		},
+		{
+			subtest:  "default",
+			config:   `{"ttl": 30}`,
+			expected: "/service/",
+		},
+		{
+			subtest:       "invalid namespace",
+			config:        `{"ttl": 30, "namespace": 42}`,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.config), nil
+		}}
+		p := New(testLogger, client)
+
+		namespace, err := p.GetDCSNamespace(context.Background(), newMockPod("192.168.100.1"))
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if namespace != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.subtest, tt.expected, namespace)
+		}
+	}
+}
+
+func TestGetFlattenedConfig(t *testing.T) {
+	config := `{"ttl": 30, "postgresql": {"parameters": {"max_connections": 100}, "pg_hba": []}, "slots": [{"name": "logical_slot", "type": "logical"}, {"name": "physical_slot"}], "standby_cluster": {}}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, config), nil
+	}}
+	p := New(testLogger, client)
+
+	flattened, err := p.GetFlattenedConfig(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("could not get flattened config: %v", err)
+	}
+	expected := map[string]interface{}{
+		"ttl":                                   float64(30),
+		"postgresql.parameters.max_connections": float64(100),
+		"postgresql.pg_hba":                     []interface{}{},
+		"slots[0].name":                         "logical_slot",
+		"slots[0].type":                         "logical",
+		"slots[1].name":                         "physical_slot",
+		"standby_cluster":                       map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(flattened, expected) {
+		t.Errorf("expected %v, got %v", expected, flattened)
+	}
+}
+
+func TestGetWatchdogConfig(t *testing.T) {
+	var requests int
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		requests++
+		return newMockResponse(http.StatusOK, `{"ttl": 30}`), nil
+	}}
+	p := New(testLogger, client)
+
+	watchdog, err := p.GetWatchdogConfig(context.Background(), newMockPod("192.168.100.1"))
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if watchdog != (WatchdogConfig{}) || requests != 0 {
+		t.Errorf("expected no watchdog config and no request, got %#v after %d requests", watchdog, requests)
+	}
+}
+
+func TestVerifyParametersApplied(t *testing.T) {
+	stored := `{"loop_wait": 10, "postgresql": {"parameters": {"work_mem": "8MB", "max_connections": 200}}}`
+	expected := map[string]string{"work_mem": "8MB", "max_connections": "200"}
+	pendingConnections := `{"state": "running", "role": "master", "pending_restart": true, "pending_restart_reason": {"max_connections": {"old_value": "100", "new_value": "200"}}}`
+	running := `{"state": "running", "role": "master"}`
+
+	var testTable = []struct {
+		subtest            string
+		configs            []string
+		members            []string
+		step               time.Duration
+		expected           bool
+		expectedMismatched []string
+		expectedPolls      int
+	}{
+		{
+			subtest:       "applied after restart",
+			configs:       []string{stored},
+			members:       []string{pendingConnections, pendingConnections, running},
+			step:          time.Minute,
+			expected:      true,
+			expectedPolls: 3,
+		},
+		{
+			subtest:       "reload waits for loop_wait",
+			configs:       []string{stored},
+			members:       []string{running},
+			step:          4 * time.Second,
+			expected:      true,
+			expectedPolls: 3,
+		},
+		{
+			subtest:            "restart still pending",
+			configs:            []string{stored},
+			members:            []string{pendingConnections},
+			step:               time.Minute,
+			expectedMismatched: []string{"max_connections"},
+		},
+		{
+			subtest:            "pending restart without reason",
+			configs:            []string{stored},
+			members:            []string{`{"state": "running", "role": "master", "pending_restart": true}`},
+			step:               time.Minute,
+			expectedMismatched: []string{"max_connections", "work_mem"},
+		},
+		{
+			subtest:            "not stored",
+			configs:            []string{`{"postgresql": {"parameters": {"work_mem": "4MB", "max_connections": 200}}}`},
+			members:            []string{running},
+			step:               time.Minute,
+			expectedMismatched: []string{"work_mem"},
+		},
+	}
+	for _, tt := range testTable {
+		var configPolls, memberPolls int
+		next := func(bodies []string, polls *int) string {
+			body := bodies[len(bodies)-1]
+			if *polls < len(bodies) {
+				body = bodies[*polls]
+			}
+			*polls++
+			return body
+		}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.URL.Path == configPath {
+				return newMockResponse(http.StatusOK, next(tt.configs, &configPolls)), nil
+			}
+			return newMockResponse(http.StatusOK, next(tt.members, &memberPolls)), nil
+		}}
+		clock := &fakeClock{now: time.Date(2021, 2, 19, 14, 0, 0, 0, time.UTC), step: tt.step}
+		p := New(testLogger, client, WithApplyTimeout(time.Hour), WithClock(clock), WithPollInterval(0))
+
+		applied, mismatched, err := p.VerifyParametersApplied(context.Background(), newMockPod("192.168.100.1"), expected)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if applied != tt.expected || !reflect.DeepEqual(mismatched, tt.expectedMismatched) {
+			t.Errorf("%s: expected applied %t with %v, got %t with %v", tt.subtest, tt.expected, tt.expectedMismatched, applied, mismatched)
+		}
+		if tt.expectedPolls != 0 && memberPolls != tt.expectedPolls {
+			t.Errorf("%s: expected %d polls, got %d", tt.subtest, tt.expectedPolls, memberPolls)
+		}
+	}
+}
+
+func TestReplicationReady(t *testing.T) {
+	var testTable = []struct {
+		subtest        string
+		config         string
+		expected       bool
+		expectedReason string
+	}{
+		{
+			subtest:  "configured for replication",
+			config:   `{"postgresql": {"parameters": {"wal_level": "replica", "max_wal_senders": 10, "hot_standby": "on"}}}`,
+			expected: true,
+		},
+		{
+			subtest:  "Patroni defaults",
+			config:   `{"postgresql": {"parameters": {"max_connections": 100}}}`,
+			expected: true,
+		},
+		{
+			subtest:        "minimal wal_level",
+			config:         `{"postgresql": {"parameters": {"wal_level": "minimal", "max_wal_senders": 0}}}`,
+			expectedReason: `wal_level is "minimal", but at least replica is required`,
+		},
+		{
+			subtest:        "no wal senders",
+			config:         `{"postgresql": {"parameters": {"wal_level": "logical", "max_wal_senders": "0"}}}`,
+			expectedReason: `max_wal_senders is "0", but must be positive`,
+		},
+		{
+			subtest:  "hot standby managed by Patroni",
+			config:   `{"postgresql": {"parameters": {"hot_standby": false}}}`,
+			expected: true,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.config), nil
+		}}
+		p := New(testLogger, client)
+
+		ready, reason, err := p.ReplicationReady(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if ready != tt.expected || reason != tt.expectedReason {
+			t.Errorf("%s: expected %t %q, got %t %q", tt.subtest, tt.expected, tt.expectedReason, ready, reason)
+		}
+	}
+}
+
+func TestConfigSyncStatus(t *testing.T) {
+	var requests int
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		requests++
+		return newMockResponse(http.StatusOK, `{"ttl": 30}`), nil
+	}}
+	p := New(testLogger, client)
+
+	applied, pending, inSync, err := p.ConfigSyncStatus(context.Background(), newMockPod("192.168.100.1"))
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if applied != "" || pending != "" || inSync || requests != 0 {
+		t.Errorf("expected no versions and no request, got %q %q %t after %d requests", applied, pending, inSync, requests)
+	}
+}
+
+func TestSetParameterWithOverrides(t *testing.T) {
+	servers := []*v1.Pod{
+		newMockNamedPod("acid-test-0", "10.0.0.1"),
+		newMockNamedPod("acid-test-1", "10.0.0.2"),
+	}
+	var testTable = []struct {
+		subtest         string
+		overrides       map[string]interface{}
+		failing         string
+		expectedPatches []string
+		expectedErrors  map[string]error
+	}{
+		{
+			subtest:         "same value everywhere",
+			overrides:       map[string]interface{}{"acid-test-1": "4GB"},
+			expectedPatches: []string{"10.0.0.1"},
+			expectedErrors:  map[string]error{},
+		},
+		{
+			subtest:         "first pod failing",
+			failing:         "10.0.0.1",
+			expectedPatches: []string{"10.0.0.1", "10.0.0.2"},
+			expectedErrors:  map[string]error{},
+		},
+		{
+			subtest:   "different values",
+			overrides: map[string]interface{}{"acid-test-1": "2GB"},
+			expectedErrors: map[string]error{
+				"acid-test-0": ErrNotSupported,
+				"acid-test-1": ErrNotSupported,
+			},
+		},
+	}
+	for _, tt := range testTable {
+		var patches []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			patches = append(patches, request.URL.Hostname())
+			var patch map[string]interface{}
+			if err := json.NewDecoder(request.Body).Decode(&patch); err != nil {
+				return nil, err
+			}
+			if value, _ := lookupConfig(patch, "postgresql", "parameters", "shared_buffers"); value != "4GB" {
+				t.Errorf("%s: unexpected patch %v", tt.subtest, patch)
+			}
+			if request.URL.Hostname() == tt.failing {
+				return newMockResponse(http.StatusServiceUnavailable, "unavailable"), nil
+			}
+			return newMockResponse(http.StatusOK, "{}"), nil
+		}}
+		p := New(testLogger, client)
+
+		errs := p.SetParameterWithOverrides(context.Background(), servers, "shared_buffers", "4GB", tt.overrides)
+		if !reflect.DeepEqual(patches, tt.expectedPatches) {
+			t.Errorf("%s: expected patches sent to %v, got %v", tt.subtest, tt.expectedPatches, patches)
+		}
+		if len(errs) != len(tt.expectedErrors) {
+			t.Errorf("%s: expected errors %v, got %v", tt.subtest, tt.expectedErrors, errs)
+		}
+		for name, expected := range tt.expectedErrors {
+			if !errors.Is(errs[name], expected) {
+				t.Errorf("%s: expected error %v for %s, got %v", tt.subtest, expected, name, errs[name])
+			}
+		}
+	}
+}
+
+func TestDeleteConfigKeys(t *testing.T) {
+	var testTable = []struct {
+		subtest         string
+		keys            []string
+		expectedPatches []string
+		expectedError   bool
+	}{
+		{
+			subtest:         "nested keys",
+			keys:            []string{"postgresql.parameters.work_mem", "postgresql.parameters.max_connections", "master_start_timeout"},
+			expectedPatches: []string{`{"master_start_timeout":null,"postgresql":{"parameters":{"max_connections":null,"work_mem":null}}}` + "\n"},
+		},
+		{
+			subtest:         "dotted parameter name",
+			keys:            []string{"postgresql.parameters.pg_stat_statements.max", "postgresql.parameters.auto_explain.log_min_duration"},
+			expectedPatches: []string{`{"postgresql":{"parameters":{"auto_explain.log_min_duration":null,"pg_stat_statements.max":null}}}` + "\n"},
+		},
+		{
+			subtest:         "parent deleted",
+			keys:            []string{"standby_cluster", "standby_cluster.host", "postgresql.parameters.work_mem", "postgresql.parameters"},
+			expectedPatches: []string{`{"postgresql":{"parameters":null},"standby_cluster":null}` + "\n"},
+		},
+		{
+			subtest: "no keys",
+		},
+		{
+			subtest:       "invalid key",
+			keys:          []string{"postgresql..work_mem"},
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		var patches []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			content, err := ioutil.ReadAll(request.Body)
+			patches = append(patches, string(content))
+			return newMockResponse(http.StatusOK, "{}"), err
+		}}
+		p := New(testLogger, client)
+
+		err := p.DeleteConfigKeys(context.Background(), newMockPod("192.168.100.1"), tt.keys)
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if !reflect.DeepEqual(patches, tt.expectedPatches) {
+			t.Errorf("%s: expected patches %q, got %q", tt.subtest, tt.expectedPatches, patches)
+		}
+	}
+}
+
+func TestSetConfigSections(t *testing.T) {
+	pause := true
+	var testTable = []struct {
+		subtest         string
+		sections        ConfigSections
+		expectedPatches []string
+		expectedError   bool
+	}{
+		{
+			subtest: "all sections",
+			sections: ConfigSections{
+				Parameters: map[string]string{"max_connections": "200"},
+				Slots:      map[string]SlotConfig{"cdc": {Type: "logical", Database: "app", Plugin: "pgoutput"}},
+				Timings:    &Timings{TTL: 40 * time.Second, LoopWait: 10 * time.Second, RetryTimeout: 15 * time.Second},
+				Pause:      &pause,
+			},
+			expectedPatches: []string{`{"loop_wait":10,"pause":true,"postgresql":{"parameters":{"max_connections":"200"}},"retry_timeout":15,"slots":{"cdc":{"type":"logical","database":"app","plugin":"pgoutput"}},"ttl":40}` + "\n"},
+		},
+		{
+			subtest: "no sections",
+		},
+		{
+			subtest: "invalid timings",
+			sections: ConfigSections{
+				Parameters: map[string]string{"max_connections": "200"},
+				Timings:    &Timings{TTL: 20 * time.Second, LoopWait: 10 * time.Second, RetryTimeout: 10 * time.Second},
+			},
+			expectedError: true,
+		},
+		{
+			subtest: "invalid slot",
+			sections: ConfigSections{
+				Slots: map[string]SlotConfig{"cdc": {Type: "logical"}},
+			},
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		var patches []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			content, err := ioutil.ReadAll(request.Body)
+			patches = append(patches, string(content))
+			return newMockResponse(http.StatusOK, "{}"), err
+		}}
+		p := New(testLogger, client)
+
+		err := p.SetConfigSections(context.Background(), newMockPod("192.168.100.1"), tt.sections)
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if !reflect.DeepEqual(patches, tt.expectedPatches) {
+			t.Errorf("%s: expected patches %q, got %q", tt.subtest, tt.expectedPatches, patches)
+		}
+	}
+}
+
+func TestMutableKeyAllowlist(t *testing.T) {
+	var patches int
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		patches++
+		return newMockResponse(http.StatusOK, "{}"), nil
+	}}
+	p := New(testLogger, client, WithMutableKeyAllowlist([]string{"ttl", "postgresql.parameters"}))
+	pod := newMockPod("192.168.100.1")
+
+	if err := p.SetPostgresParameters(context.Background(), pod, map[string]string{"work_mem": "8MB"}); err != nil {
+		t.Errorf("expected parameter change to be allowed, got %v", err)
+	}
+	if err := p.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 40}); err != nil {
+		t.Errorf("expected ttl change to be allowed, got %v", err)
+	}
+	err := p.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 40, "synchronous_mode": true, "postgresql": map[string]interface{}{"use_slots": false}})
+	if err == nil {
+		t.Errorf("expected change outside of the allow-list to be rejected")
+	} else if expected := "config keys are not allowed to be changed: postgresql.use_slots, synchronous_mode"; err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err)
+	}
+	if patches != 2 {
+		t.Errorf("expected 2 patches to be sent, got %d", patches)
+	}
+
+	patches = 0
+	p = New(testLogger, client, WithMutableKeyAllowlist([]string{"postgresql.parameters.work_mem", "slots.cdc"}))
+	if err := p.SetPostgresParameters(context.Background(), pod, map[string]string{"work_mem": "8MB"}); err != nil {
+		t.Errorf("expected allowed parameter change to be allowed, got %v", err)
+	}
+	err = p.SetPostgresParameters(context.Background(), pod, map[string]string{"work_mem": "8MB", "shared_buffers": "1GB"})
+	if expected := "config keys are not allowed to be changed: postgresql.parameters.shared_buffers"; err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	slots := map[string]SlotConfig{"cdc": {Type: "logical", Database: "app", Plugin: "pgoutput"}}
+	if err := p.SetConfigSections(context.Background(), pod, ConfigSections{Slots: slots}); err != nil {
+		t.Errorf("expected allowed slot change to be allowed, got %v", err)
+	}
+	if patches != 2 {
+		t.Errorf("expected 2 patches to be sent, got %d", patches)
+	}
+}
+
+func TestConfigDrift(t *testing.T) {
+	configs := map[string]string{
+		"192.168.100.1": `{"ttl": 30, "postgresql": {"parameters": {"max_connections": 100, "work_mem": "4MB"}}}`,
+		"192.168.100.2": `{"ttl": 30, "postgresql": {"parameters": {"max_connections": 200, "work_mem": "4MB"}}}`,
+		"192.168.100.3": `{"ttl": 30, "postgresql": {"parameters": {"max_connections": 100, "work_mem": "4MB", "wal_keep_size": "1GB"}}}`,
+	}
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		config, ok := configs[request.URL.Hostname()]
+		if !ok {
+			return newMockResponse(http.StatusServiceUnavailable, "unavailable"), nil
+		}
+		return newMockResponse(http.StatusOK, config), nil
+	}}
+	p := New(testLogger, client)
+
+	servers := []*v1.Pod{
+		newMockNamedPod("acid-test-0", "192.168.100.1"),
+		newMockNamedPod("acid-test-1", "192.168.100.2"),
+		newMockNamedPod("acid-test-2", "192.168.100.3"),
+		newMockNamedPod("acid-test-3", "192.168.100.4"),
+	}
+	drift, err := p.ConfigDrift(context.Background(), servers)
+	if err == nil || !strings.Contains(err.Error(), "acid-test-3") {
+		t.Errorf("expected an error for the unavailable pod, got %v", err)
+	}
+	expected := map[string]map[string]interface{}{
+		"postgresql.parameters.max_connections": {
+			"acid-test-0": float64(100),
+			"acid-test-1": float64(200),
+			"acid-test-2": float64(100),
+		},
+		"postgresql.parameters.wal_keep_size": {
+			"acid-test-0": nil,
+			"acid-test-1": nil,
+			"acid-test-2": "1GB",
+		},
+	}
+	if !reflect.DeepEqual(drift, expected) {
+		t.Errorf("expected drift %v, got %v", expected, drift)
+	}
+}
+
+func TestGetDynamicConfig(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		config        string
+		expected      DynamicConfig
+		expectedError bool
+	}{
+		{
+			subtest: "full config",
+			config: `{"ttl": 30, "loop_wait": 10, "retry_timeout": 10, "maximum_lag_on_failover": 33554432, "pause": true,
+				"postgresql": {"parameters": {"max_connections": 100, "work_mem": "4MB", "hot_standby": "on"}}, "synchronous_mode": true}`,
+			expected: DynamicConfig{
+				TTL:                  30,
+				LoopWait:             10,
+				RetryTimeout:         10,
+				MaximumLagOnFailover: 33554432,
+				Pause:                true,
+				Parameters:           map[string]string{"max_connections": "100", "work_mem": "4MB", "hot_standby": "on"},
+			},
+		},
+		{
+			subtest:  "empty config",
+			config:   `{}`,
+			expected: DynamicConfig{Parameters: map[string]string{}},
+		},
+		{
+			subtest:       "malformed ttl",
+			config:        `{"ttl": "thirty"}`,
+			expectedError: true,
+		},
+		{
+			subtest:       "malformed parameters",
+			config:        `{"postgresql": {"parameters": ["max_connections"]}}`,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.config), nil
+		}}
+		p := New(testLogger, client)
+
+		config, err := p.GetDynamicConfig(context.Background(), newMockPod("192.168.100.1"))
+		if (err != nil) != tt.expectedError {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if !tt.expectedError && !reflect.DeepEqual(config, tt.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tt.subtest, tt.expected, config)
+		}
+	}
+}
+
+func TestManagedParameters(t *testing.T) {
+	config := `{"ttl": 30, "postgresql": {"parameters": {"max_connections": 100, "port": 5433, "hot_standby": "off"}}}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, config), nil
+	}}
+	p := New(testLogger, client)
+
+	managed, err := p.ManagedParameters(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(managed) != len(managedParameters) {
+		t.Errorf("expected all %d managed parameters, got %v", len(managedParameters), managed)
+	}
+	if _, ok := managed["max_connections"]; ok {
+		t.Errorf("expected max_connections not to be managed")
+	}
+	if managed["port"] != float64(5433) || managed["hot_standby"] != "off" {
+		t.Errorf("expected the values set in the config, got %v", managed)
+	}
+	if value, ok := managed["listen_addresses"]; !ok || value != nil {
+		t.Errorf("expected listen_addresses without value, got %v", managed)
+	}
+}
+
+func TestSetManagedParameterWarns(t *testing.T) {
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+	}}
+	logger, hook := test.NewNullLogger()
+	p := New(logger.WithField("test", "managed"), client)
+
+	err := p.SetPostgresParameters(context.Background(), newMockPod("192.168.100.1"), map[string]string{"port": "5433", "work_mem": "8MB"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "port") {
+		t.Errorf("expected a single warning about port, got %v", warnings)
+	}
+}
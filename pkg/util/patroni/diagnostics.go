@@ -0,0 +1,68 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// diagnosticPaths are the endpoints collected by CollectDiagnostics
+var diagnosticPaths = []string{statusPath, configPath, clusterPath, historyPath}
+
+// NodeDiagnostics holds the raw responses of one member, keyed by endpoint
+// path, and the errors of the endpoints which could not be read
+type NodeDiagnostics struct {
+	Responses map[string]json.RawMessage `json:"responses"`
+	Errors    map[string]string          `json:"errors,omitempty"`
+}
+
+// DiagnosticBundle is a snapshot of the Patroni API of all members of a
+// cluster, keyed by pod name
+type DiagnosticBundle struct {
+	Nodes map[string]NodeDiagnostics `json:"nodes"`
+}
+
+// CollectDiagnostics reads the status, config, cluster and history endpoints
+// of every pod. Failing endpoints are recorded in the bundle, pods of which no
+// endpoint could be read are also reported in the error.
+func (p *Patroni) CollectDiagnostics(ctx context.Context, servers []*v1.Pod) (DiagnosticBundle, error) {
+	bundle := DiagnosticBundle{Nodes: make(map[string]NodeDiagnostics, len(servers))}
+	errs := make(map[string]error)
+	for _, server := range servers {
+		node := p.collectNodeDiagnostics(ctx, server)
+		if len(node.Responses) == 0 {
+			errs[server.Name] = fmt.Errorf("no endpoint could be read")
+		}
+		bundle.Nodes[server.Name] = node
+	}
+	return bundle, membersError(errs)
+}
+
+func (p *Patroni) collectNodeDiagnostics(ctx context.Context, server *v1.Pod) NodeDiagnostics {
+	node := NodeDiagnostics{
+		Responses: make(map[string]json.RawMessage),
+		Errors:    make(map[string]string),
+	}
+	apiURLString, err := p.apiURL(server)
+	if err != nil {
+		for _, path := range diagnosticPaths {
+			node.Errors[path] = err.Error()
+		}
+		return node
+	}
+
+	for _, path := range diagnosticPaths {
+		// the status endpoint answers with a full body on 503, so it is kept
+		// whenever it is valid JSON
+		body, err := p.httpGet(ctx, apiURLString+path)
+		if body != "" && json.Valid([]byte(body)) {
+			node.Responses[path] = json.RawMessage(body)
+		}
+		if err != nil {
+			node.Errors[path] = err.Error()
+		}
+	}
+	return node
+}
@@ -0,0 +1,61 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCollectDiagnostics(t *testing.T) {
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		host := request.URL.Hostname()
+		switch {
+		case host == "10.0.0.3":
+			return nil, errors.New("connection refused")
+		case host == "10.0.0.2" && request.URL.Path == historyPath:
+			return nil, errors.New("connection reset by peer")
+		case host == "10.0.0.2" && request.URL.Path == statusPath:
+			return newMockResponse(http.StatusServiceUnavailable, `{"state": "starting", "role": "replica"}`), nil
+		}
+		return newMockResponse(http.StatusOK, `{"path": "`+request.URL.Path+`"}`), nil
+	}}
+	p := New(testLogger, client)
+	pods := []*v1.Pod{
+		newMockNamedPod("acid-test-0", "10.0.0.1"),
+		newMockNamedPod("acid-test-1", "10.0.0.2"),
+		newMockNamedPod("acid-test-2", "10.0.0.3"),
+	}
+
+	bundle, err := p.CollectDiagnostics(context.Background(), pods)
+	if err == nil || !strings.Contains(err.Error(), "acid-test-2") || strings.Contains(err.Error(), "acid-test-1") {
+		t.Errorf("expected error only for unreachable acid-test-2, got %v", err)
+	}
+	if len(bundle.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes in bundle, got %d", len(bundle.Nodes))
+	}
+
+	leader := bundle.Nodes["acid-test-0"]
+	if len(leader.Responses) != 4 || len(leader.Errors) != 0 {
+		t.Errorf("expected all endpoints of acid-test-0, got %v", leader)
+	}
+	if string(leader.Responses[historyPath]) != `{"path": "/history"}` {
+		t.Errorf("unexpected history response %s", leader.Responses[historyPath])
+	}
+
+	replica := bundle.Nodes["acid-test-1"]
+	if len(replica.Responses) != 3 || string(replica.Responses[statusPath]) != `{"state": "starting", "role": "replica"}` {
+		t.Errorf("expected status, config and cluster of acid-test-1, got %v", replica.Responses)
+	}
+	if len(replica.Errors) != 2 || replica.Errors[historyPath] == "" || replica.Errors[statusPath] == "" {
+		t.Errorf("expected history and status errors of acid-test-1, got %v", replica.Errors)
+	}
+
+	unreachable := bundle.Nodes["acid-test-2"]
+	if len(unreachable.Responses) != 0 || len(unreachable.Errors) != 4 {
+		t.Errorf("expected only errors for acid-test-2, got %v", unreachable)
+	}
+}
@@ -0,0 +1,119 @@
+package patroni
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// apiOperation is a call of the Patroni API whose HTTP method and path may
+// differ between Patroni versions
+type apiOperation string
+
+const (
+	opFailover    apiOperation = "failover"
+	opSwitchover  apiOperation = "switchover"
+	opPatchConfig apiOperation = "patch config"
+	opRestart     apiOperation = "restart"
+)
+
+type endpoint struct {
+	method string
+	path   string
+}
+
+// versionedEndpoint is used for Patroni versions from minVersion on, an
+// empty minVersion matches every version
+type versionedEndpoint struct {
+	minVersion string
+	endpoint   endpoint
+}
+
+// endpoints lists the endpoints of each operation, newest Patroni version
+// first. The last entry should have no minimal version, it is used when the
+// version is older than all others or unknown.
+var endpoints = map[apiOperation][]versionedEndpoint{
+	opFailover:    {{endpoint: endpoint{http.MethodPost, failoverPath}}},
+	opSwitchover:  {{endpoint: endpoint{http.MethodPost, switchoverPath}}},
+	opPatchConfig: {{endpoint: endpoint{http.MethodPatch, configPath}}},
+	opRestart:     {{endpoint: endpoint{http.MethodPost, restartPath}}},
+}
+
+// endpointFor returns the endpoint of the operation for the Patroni version
+// of the member. The version is only looked up if the endpoint depends on it.
+func (p *Patroni) endpointFor(ctx context.Context, server *v1.Pod, op apiOperation) endpoint {
+	candidates := endpoints[op]
+	if len(candidates) == 1 {
+		return candidates[0].endpoint
+	}
+	version := p.patroniVersion(ctx, server)
+	for _, candidate := range candidates {
+		if candidate.minVersion == "" || (version != "" && compareVersions(version, candidate.minVersion) >= 0) {
+			return candidate.endpoint
+		}
+	}
+	return candidates[len(candidates)-1].endpoint
+}
+
+// call sends the body to the endpoint of the operation on the member
+func (p *Patroni) call(ctx context.Context, server *v1.Pod, op apiOperation, body *bytes.Buffer) error {
+	apiURLString, err := p.apiURL(server)
+	if err != nil {
+		return err
+	}
+	e := p.endpointFor(ctx, server, op)
+	return p.httpPostOrPatch(ctx, e.method, apiURLString+e.path, body)
+}
+
+// patroniVersion returns the Patroni version of the member, read from its
+// status unless known from an earlier call. It is empty if it could not be
+// determined.
+func (p *Patroni) patroniVersion(ctx context.Context, server *v1.Pod) string {
+	p.mu.Lock()
+	version, ok := p.versions[server.Name]
+	p.mu.Unlock()
+	if ok {
+		return version
+	}
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return ""
+	}
+	return data.Patroni.Version
+}
+
+// rememberVersion caches the Patroni version reported by a member
+func (p *Patroni) rememberVersion(server *v1.Pod, version string) {
+	if version == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.versions[server.Name] = version
+}
+
+// compareVersions compares dotted version numbers like "3.0.4" component by
+// component, missing or non-numeric components count as 0
+func compareVersions(a, b string) int {
+	left, right := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(left) || i < len(right); i++ {
+		var l, r int
+		if i < len(left) {
+			l, _ = strconv.Atoi(left[i])
+		}
+		if i < len(right) {
+			r, _ = strconv.Atoi(right[i])
+		}
+		if l != r {
+			if l < r {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
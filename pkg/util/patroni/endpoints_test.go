@@ -0,0 +1,98 @@
+package patroni
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestEndpointForVersion(t *testing.T) {
+	defaults := endpoints[opPatchConfig]
+	defer func() {
+		endpoints[opPatchConfig] = defaults
+	}()
+	endpoints[opPatchConfig] = []versionedEndpoint{
+		{minVersion: "4.0.0", endpoint: endpoint{http.MethodPut, configPath}},
+		{endpoint: endpoint{http.MethodPatch, configPath}},
+	}
+
+	var testTable = []struct {
+		subtest        string
+		version        string
+		expectedMethod string
+	}{
+		{
+			subtest:        "older version",
+			version:        "3.3.2",
+			expectedMethod: http.MethodPatch,
+		},
+		{
+			subtest:        "newer version",
+			version:        "4.0.1",
+			expectedMethod: http.MethodPut,
+		},
+		{
+			subtest:        "unknown version",
+			version:        "",
+			expectedMethod: http.MethodPatch,
+		},
+	}
+	for _, tt := range testTable {
+		var methods []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodGet {
+				return newMockResponse(http.StatusOK, `{"state": "running", "role": "master", "patroni": {"version": "`+tt.version+`"}}`), nil
+			}
+			methods = append(methods, request.Method)
+			return newMockResponse(http.StatusOK, "{}"), nil
+		}}
+		p := New(testLogger, client)
+
+		pod := newMockNamedPod("acid-test-0", "192.168.100.1")
+		for i := 0; i < 2; i++ {
+			if err := p.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 30}); err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+			}
+		}
+		if len(methods) != 2 || methods[0] != tt.expectedMethod || methods[1] != tt.expectedMethod {
+			t.Errorf("%s: expected %s, got %v", tt.subtest, tt.expectedMethod, methods)
+		}
+	}
+}
+
+func TestEndpointForDefaults(t *testing.T) {
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request %s %s", request.Method, request.URL)
+		return nil, nil
+	}}
+	p := New(testLogger, client)
+
+	for op, expected := range map[apiOperation]endpoint{
+		opFailover:    {http.MethodPost, failoverPath},
+		opSwitchover:  {http.MethodPost, switchoverPath},
+		opPatchConfig: {http.MethodPatch, configPath},
+		opRestart:     {http.MethodPost, restartPath},
+	} {
+		if e := p.endpointFor(context.Background(), newMockPod("192.168.100.1"), op); e != expected {
+			t.Errorf("expected %v for %s, got %v", expected, op, e)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	var testTable = []struct {
+		a, b     string
+		expected int
+	}{
+		{"3.0.4", "3.0.4", 0},
+		{"3.0", "3.0.0", 0},
+		{"3.0.4", "3.1.0", -1},
+		{"4.0.0", "3.3.2", 1},
+		{"2.10.0", "2.9.1", 1},
+	}
+	for _, tt := range testTable {
+		if result := compareVersions(tt.a, tt.b); result != tt.expected {
+			t.Errorf("expected compareVersions(%q, %q) to be %d, got %d", tt.a, tt.b, tt.expected, result)
+		}
+	}
+}
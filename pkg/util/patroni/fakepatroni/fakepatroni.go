@@ -0,0 +1,162 @@
+package fakepatroni
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/zalando/postgres-operator/pkg/util/patroni"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Call is a recorded call of the fake, Args holds the arguments following
+// the pod
+type Call struct {
+	Method string
+	Pod    string
+	Args   []interface{}
+}
+
+// Fake implements patroni.Interface without talking to Patroni. It records
+// all calls and answers with the programmed responses.
+type Fake struct {
+	mu    sync.Mutex
+	calls []Call
+
+	// MemberData is returned by GetMemberData, keyed by pod name
+	MemberData map[string]patroni.MemberData
+	// Config is returned by GetConfig
+	Config map[string]interface{}
+	// Errors are returned by the method with the given name, e.g. "Restart"
+	Errors map[string]error
+}
+
+var _ patroni.Interface = &Fake{}
+
+// New creates a fake without programmed responses
+func New() *Fake {
+	return &Fake{
+		MemberData: make(map[string]patroni.MemberData),
+		Config:     make(map[string]interface{}),
+		Errors:     make(map[string]error),
+	}
+}
+
+// WithMemberData seeds the member data of the named pods, keyed by pod name
+func (f *Fake) WithMemberData(members map[string]patroni.MemberData) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, data := range members {
+		f.MemberData[name] = data
+	}
+	return f
+}
+
+// WithConfig seeds the config returned by GetConfig, keys already set are
+// overwritten
+func (f *Fake) WithConfig(config map[string]interface{}) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, value := range config {
+		f.Config[key] = value
+	}
+	return f
+}
+
+// WithError makes the method with the given name, e.g. "Switchover", fail
+func (f *Fake) WithError(method string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Errors[method] = err
+	return f
+}
+
+// record adds a call and returns the error programmed for the method
+func (f *Fake) record(method string, pod *v1.Pod, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, Call{Method: method, Pod: pod.Name, Args: args})
+	return f.Errors[method]
+}
+
+// Calls returns all recorded calls in order
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Call{}, f.calls...)
+}
+
+// CallsTo returns the recorded calls of a single method in order
+func (f *Fake) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range f.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Switchover records the call
+func (f *Fake) Switchover(ctx context.Context, master *v1.Pod, candidate string) error {
+	return f.record("Switchover", master, candidate)
+}
+
+// SetPostgresParameters records the call
+func (f *Fake) SetPostgresParameters(ctx context.Context, server *v1.Pod, options map[string]string) error {
+	return f.record("SetPostgresParameters", server, options)
+}
+
+// GetMemberData returns the member data programmed for the pod
+func (f *Fake) GetMemberData(ctx context.Context, server *v1.Pod) (patroni.MemberData, error) {
+	if err := f.record("GetMemberData", server); err != nil {
+		return patroni.MemberData{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.MemberData[server.Name]
+	if !ok {
+		return patroni.MemberData{}, fmt.Errorf("no member data for pod %s", server.Name)
+	}
+	return data, nil
+}
+
+// Restart records the call. Like Patroni it only restarts if the member data
+// of the pod reports a pending restart, which is cleared then.
+func (f *Fake) Restart(ctx context.Context, server *v1.Pod) (bool, error) {
+	if err := f.record("Restart", server); err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.MemberData[server.Name]
+	if !ok || !data.PendingRestart {
+		return false, nil
+	}
+	data.PendingRestart = false
+	f.MemberData[server.Name] = data
+	return true, nil
+}
+
+// GetConfig returns the programmed config
+func (f *Fake) GetConfig(ctx context.Context, server *v1.Pod) (map[string]interface{}, error) {
+	if err := f.record("GetConfig", server); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Config, nil
+}
+
+// SetConfig records the call
+func (f *Fake) SetConfig(ctx context.Context, server *v1.Pod, config map[string]interface{}) error {
+	return f.record("SetConfig", server, config)
+}
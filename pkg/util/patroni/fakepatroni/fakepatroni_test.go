@@ -0,0 +1,101 @@
+package fakepatroni
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zalando/postgres-operator/pkg/util/patroni"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPod(name string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func TestFakeRecordsCalls(t *testing.T) {
+	fake := New()
+	master := newPod("acid-test-0")
+
+	if err := fake.Switchover(context.Background(), master, "acid-test-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restarted, err := fake.Restart(context.Background(), newPod("acid-test-1")); err != nil || restarted {
+		t.Fatalf("expected no restart without pending restart, got %t with error %v", restarted, err)
+	}
+
+	expected := []Call{
+		{Method: "Switchover", Pod: "acid-test-0", Args: []interface{}{"acid-test-1"}},
+		{Method: "Restart", Pod: "acid-test-1"},
+	}
+	if calls := fake.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %#v, got %#v", expected, calls)
+	}
+	if calls := fake.CallsTo("Restart"); len(calls) != 1 || calls[0].Pod != "acid-test-1" {
+		t.Errorf("expected a single restart of acid-test-1, got %#v", calls)
+	}
+}
+
+func TestFakeProgrammedResponses(t *testing.T) {
+	fake := New()
+	pod := newPod("acid-test-0")
+	data := patroni.MemberData{State: "running", Role: "master", ServerVersion: 130002}
+	fake.MemberData["acid-test-0"] = data
+	fake.Config["ttl"] = 30
+	fake.Errors["SetConfig"] = errors.New("patroni returned '503'")
+
+	result, err := fake.GetMemberData(context.Background(), pod)
+	if err != nil || !reflect.DeepEqual(result, data) {
+		t.Errorf("expected member data %#v, got %#v with error %v", data, result, err)
+	}
+	if _, err := fake.GetMemberData(context.Background(), newPod("acid-test-1")); err == nil {
+		t.Errorf("expected an error for a pod without member data")
+	}
+
+	fake.MemberData["acid-test-0"] = patroni.MemberData{PendingRestart: true}
+	if restarted, err := fake.Restart(context.Background(), pod); err != nil || !restarted {
+		t.Errorf("expected a restart for a pending restart, got %t with error %v", restarted, err)
+	}
+	if fake.MemberData["acid-test-0"].PendingRestart {
+		t.Errorf("expected the pending restart to be cleared")
+	}
+
+	config, err := fake.GetConfig(context.Background(), pod)
+	if err != nil || config["ttl"] != 30 {
+		t.Errorf("expected programmed config, got %v with error %v", config, err)
+	}
+
+	if err := fake.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 20}); err == nil {
+		t.Errorf("expected programmed error from SetConfig")
+	}
+	if calls := fake.CallsTo("SetConfig"); len(calls) != 1 {
+		t.Errorf("expected failing call to be recorded, got %#v", calls)
+	}
+}
+
+func TestFakeSeedHelpers(t *testing.T) {
+	fake := New().
+		WithMemberData(map[string]patroni.MemberData{
+			"acid-test-0": {State: "running", Role: "master"},
+			"acid-test-1": {State: "running", Role: "replica"},
+		}).
+		WithConfig(map[string]interface{}{"ttl": 30, "loop_wait": 10}).
+		WithError("Switchover", errors.New("no candidate"))
+
+	data, err := fake.GetMemberData(context.Background(), newPod("acid-test-1"))
+	if err != nil || data.Role != "replica" {
+		t.Errorf("expected seeded member data, got %#v with error %v", data, err)
+	}
+	config, err := fake.GetConfig(context.Background(), newPod("acid-test-0"))
+	if err != nil || config["ttl"] != 30 || config["loop_wait"] != 10 {
+		t.Errorf("expected seeded config, got %v with error %v", config, err)
+	}
+	if err := fake.Switchover(context.Background(), newPod("acid-test-0"), "acid-test-1"); err == nil {
+		t.Errorf("expected seeded error from Switchover")
+	}
+	if calls := fake.CallsTo("Switchover"); len(calls) != 1 || !reflect.DeepEqual(calls[0].Args, []interface{}{"acid-test-1"}) {
+		t.Errorf("expected switchover to acid-test-1 to be recorded, got %#v", calls)
+	}
+}
@@ -0,0 +1,245 @@
+package patroni
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// AcceptsConnections reports whether Postgres of the member is ready for
+// clients, i.e. it runs as leader or replica. Patroni itself being reachable
+// is not sufficient, Postgres may still be starting or stopped.
+func (p *Patroni) AcceptsConnections(ctx context.Context, server *v1.Pod) (bool, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return false, err
+	}
+	if data.State != "running" {
+		return false, nil
+	}
+	switch data.Role {
+	case "master", "primary", "standby_leader", "replica":
+		return true, nil
+	}
+	return false, nil
+}
+
+// lightweightTimeout limits each probe of the lightweight mode
+const lightweightTimeout = 2 * time.Second
+
+// Healthy tells whether Patroni and Postgres of the member are running. In
+// lightweight mode the member is healthy if both /liveness and /readiness
+// answer 200, otherwise if the member data reports Postgres running.
+func (p *Patroni) Healthy(ctx context.Context, server *v1.Pod) (bool, error) {
+	if !p.lightweight {
+		data, err := p.GetMemberData(ctx, server)
+		if err != nil {
+			return false, err
+		}
+		return data.State == "running", nil
+	}
+
+	for _, path := range []string{livenessPath, readinessPath} {
+		probeCtx, cancel := context.WithTimeout(ctx, lightweightTimeout)
+		ok, err := p.probe(probeCtx, server, path)
+		cancel()
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// IsHealthy tells whether Patroni of the member is running, using the
+// /liveness endpoint. Other statuses than 200 and 503 are errors.
+func (p *Patroni) IsHealthy(ctx context.Context, server *v1.Pod) (bool, error) {
+	return p.probe(ctx, server, livenessPath)
+}
+
+// IsReady tells whether the member runs Postgres as leader or streaming
+// replica, using the /readiness endpoint. Other statuses than 200 and 503
+// are errors.
+func (p *Patroni) IsReady(ctx context.Context, server *v1.Pod) (bool, error) {
+	return p.probe(ctx, server, readinessPath)
+}
+
+// probe requests a health endpoint, which answers 200 if the check passed
+// and 503 if it failed. The body is discarded unread and there are no
+// retries.
+func (p *Patroni) probe(ctx context.Context, server *v1.Pod, path string) (healthy bool, err error) {
+	ctx, cancel := p.withDefaultTimeout(ctx)
+	defer cancel()
+
+	apiURLString, err := p.apiURL(server)
+	if err != nil {
+		return false, err
+	}
+	url := apiURLString + path
+	request, err := p.newRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("could not create request: %v", err)
+	}
+
+	var status int
+	start := time.Now()
+	defer func() {
+		p.recordOperation(start, http.MethodGet, url, status, err)
+	}()
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return false, fmt.Errorf("could not probe %s of %s: %w", path, server.Name, err)
+	}
+	status = response.StatusCode
+	// draining lets the connection be reused
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusServiceUnavailable:
+		return false, nil
+	}
+	return false, newAPIError(status, url, nil)
+}
+
+// postmasterStartTimeLayout is the format of the postmaster start time
+const postmasterStartTimeLayout = "2006-01-02 15:04:05.999999Z07:00"
+
+// GetPostgresStartTime returns when Postgres of the member was started. A
+// start time changing between polls reveals a restart, e.g. a crash loop.
+// ErrNotSupported is returned if the member does not report it.
+func (p *Patroni) GetPostgresStartTime(ctx context.Context, server *v1.Pod) (time.Time, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if data.PostmasterStartTime == "" {
+		return time.Time{}, fmt.Errorf("%s does not report postmaster_start_time: %w", server.Name, ErrNotSupported)
+	}
+	started, err := time.Parse(postmasterStartTimeLayout, data.PostmasterStartTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse start time of %s: %v", server.Name, err)
+	}
+	return started, nil
+}
+
+// HealthWeights sets how much each aspect contributes to the health score,
+// the weights are relative to their sum
+type HealthWeights struct {
+	Leader          int
+	Replicas        int
+	Lag             int
+	PendingRestarts int
+	Reachability    int
+	// MaxLagBytes is the replication lag up to which the lag contributes
+	// fully, above it the contribution shrinks proportionally
+	MaxLagBytes int64
+}
+
+// DefaultHealthWeights is used unless the client was created
+// WithHealthWeights
+var DefaultHealthWeights = HealthWeights{
+	Leader:          40,
+	Replicas:        20,
+	Lag:             15,
+	PendingRestarts: 10,
+	Reachability:    15,
+	MaxLagBytes:     16 * 1024 * 1024,
+}
+
+// HealthDetails are the facts a health score is derived from
+type HealthDetails struct {
+	LeaderPresent    bool
+	Replicas         int
+	ExpectedReplicas int
+	// MaxLagBytes is the largest replay lag of a running replica behind the
+	// leader, zero without leader
+	MaxLagBytes     int64
+	PendingRestarts int
+	Reachable       int
+	Members         int
+}
+
+// summarizeHealth derives the health details from the member data of the
+// reachable members out of count
+func summarizeHealth(members map[string]MemberData, count int) HealthDetails {
+	details := HealthDetails{
+		Members:   count,
+		Reachable: len(members),
+	}
+	if count > 1 {
+		details.ExpectedReplicas = count - 1
+	}
+
+	var leaderLocation int64
+	for _, data := range members {
+		if data.IsLeader() {
+			details.LeaderPresent = true
+			leaderLocation = data.Xlog.Location
+		}
+		if data.PendingRestart {
+			details.PendingRestarts++
+		}
+	}
+	for _, data := range members {
+		if data.IsLeader() || data.State != "running" {
+			continue
+		}
+		details.Replicas++
+		if !details.LeaderPresent {
+			continue
+		}
+		if lag := leaderLocation - data.Xlog.ReplayedLocation; lag > details.MaxLagBytes {
+			details.MaxLagBytes = lag
+		}
+	}
+	return details
+}
+
+// score rates the details from 0 to 100 according to the weights
+func (w HealthWeights) score(details HealthDetails) int {
+	total := w.Leader + w.Replicas + w.Lag + w.PendingRestarts + w.Reachability
+	if total <= 0 || details.Members == 0 {
+		return 0
+	}
+
+	ratio := func(part, whole int) float64 {
+		if whole == 0 {
+			return 1
+		}
+		return math.Min(float64(part)/float64(whole), 1)
+	}
+	var leader, lag float64
+	if details.LeaderPresent {
+		leader, lag = 1, 1
+		if details.MaxLagBytes > w.MaxLagBytes {
+			lag = float64(w.MaxLagBytes) / float64(details.MaxLagBytes)
+		}
+	}
+	sum := float64(w.Leader)*leader +
+		float64(w.Replicas)*ratio(details.Replicas, details.ExpectedReplicas) +
+		float64(w.Lag)*lag +
+		float64(w.PendingRestarts)*(1-ratio(details.PendingRestarts, details.Reachable)) +
+		float64(w.Reachability)*ratio(details.Reachable, details.Members)
+	return int(math.Round(sum * 100 / float64(total)))
+}
+
+// HealthScore rates the health of the cluster from 0 to 100, based on the
+// presence of a leader, the running replicas compared to the pods, the
+// replication lag, pending restarts and the reachability of the members.
+// An error is returned only if no pod could be queried.
+func (p *Patroni) HealthScore(ctx context.Context, servers []*v1.Pod) (int, HealthDetails, error) {
+	members, errs := p.GetMembersData(ctx, servers)
+	details := summarizeHealth(members, len(servers))
+	if len(members) == 0 && len(errs) > 0 {
+		return 0, details, membersError(errs)
+	}
+	return p.healthWeights.score(details), details, nil
+}
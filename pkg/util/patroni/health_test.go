@@ -0,0 +1,325 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAcceptsConnections(t *testing.T) {
+	var testTable = []struct {
+		subtest  string
+		status   int
+		body     string
+		expected bool
+	}{
+		{
+			subtest:  "running leader",
+			status:   http.StatusOK,
+			body:     `{"state": "running", "role": "master"}`,
+			expected: true,
+		},
+		{
+			subtest:  "running replica",
+			status:   http.StatusOK,
+			body:     `{"state": "running", "role": "replica"}`,
+			expected: true,
+		},
+		{
+			subtest:  "starting node",
+			status:   http.StatusServiceUnavailable,
+			body:     `{"state": "starting", "role": "replica"}`,
+			expected: false,
+		},
+		{
+			subtest:  "stopped node",
+			status:   http.StatusServiceUnavailable,
+			body:     `{"state": "stopped", "role": "uninitialized"}`,
+			expected: false,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(tt.status, tt.body), nil
+		}}
+		p := New(testLogger, client)
+
+		accepts, err := p.AcceptsConnections(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if accepts != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.subtest, tt.expected, accepts)
+		}
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		options       []Option
+		responses     map[string]*http.Response
+		expected      bool
+		expectedPaths []string
+		expectedError bool
+	}{
+		{
+			subtest: "lightweight healthy",
+			options: []Option{WithLightweightMode()},
+			responses: map[string]*http.Response{
+				livenessPath:  newMockResponse(http.StatusOK, "not json"),
+				readinessPath: newMockResponse(http.StatusOK, "not json"),
+			},
+			expected:      true,
+			expectedPaths: []string{livenessPath, readinessPath},
+		},
+		{
+			subtest: "lightweight not ready",
+			options: []Option{WithLightweightMode()},
+			responses: map[string]*http.Response{
+				livenessPath:  newMockResponse(http.StatusOK, ""),
+				readinessPath: newMockResponse(http.StatusServiceUnavailable, ""),
+			},
+			expectedPaths: []string{livenessPath, readinessPath},
+		},
+		{
+			subtest: "lightweight not alive",
+			options: []Option{WithLightweightMode()},
+			responses: map[string]*http.Response{
+				livenessPath: newMockResponse(http.StatusServiceUnavailable, ""),
+			},
+			expectedPaths: []string{livenessPath},
+		},
+		{
+			subtest: "lightweight unexpected status",
+			options: []Option{WithLightweightMode()},
+			responses: map[string]*http.Response{
+				livenessPath: newMockResponse(http.StatusNotFound, ""),
+			},
+			expectedPaths: []string{livenessPath},
+			expectedError: true,
+		},
+		{
+			subtest: "member data",
+			responses: map[string]*http.Response{
+				"": newMockResponse(http.StatusOK, `{"state": "running", "role": "replica"}`),
+			},
+			expected:      true,
+			expectedPaths: []string{""},
+		},
+	}
+	for _, tt := range testTable {
+		var paths []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			paths = append(paths, request.URL.Path)
+			return tt.responses[request.URL.Path], nil
+		}}
+		p := New(testLogger, client, tt.options...)
+
+		healthy, err := p.Healthy(context.Background(), newMockPod("192.168.100.1"))
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if healthy != tt.expected {
+			t.Errorf("%s: expected healthy %t, got %t", tt.subtest, tt.expected, healthy)
+		}
+		if !reflect.DeepEqual(paths, tt.expectedPaths) {
+			t.Errorf("%s: expected requests to %v, got %v", tt.subtest, tt.expectedPaths, paths)
+		}
+	}
+}
+
+func TestIsHealthyIsReady(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		status        int
+		expected      bool
+		expectedError bool
+	}{
+		{
+			subtest:  "passing",
+			status:   http.StatusOK,
+			expected: true,
+		},
+		{
+			subtest: "failing",
+			status:  http.StatusServiceUnavailable,
+		},
+		{
+			subtest:       "unexpected status",
+			status:        http.StatusInternalServerError,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		var paths []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			paths = append(paths, request.URL.Path)
+			return newMockResponse(tt.status, ""), nil
+		}}
+		p := New(testLogger, client)
+		pod := newMockPod("192.168.100.1")
+
+		healthy, err := p.IsHealthy(context.Background(), pod)
+		if healthy != tt.expected || tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected healthy %t and error %t, got %t %v", tt.subtest, tt.expected, tt.expectedError, healthy, err)
+		}
+		ready, err := p.IsReady(context.Background(), pod)
+		if ready != tt.expected || tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected ready %t and error %t, got %t %v", tt.subtest, tt.expected, tt.expectedError, ready, err)
+		}
+		if expected := []string{livenessPath, readinessPath}; !reflect.DeepEqual(paths, expected) {
+			t.Errorf("%s: expected requests to %v, got %v", tt.subtest, expected, paths)
+		}
+	}
+}
+
+func TestIsHealthyDefaultTimeout(t *testing.T) {
+	// the member accepts the connection, but never answers
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		<-request.Context().Done()
+		return nil, request.Context().Err()
+	}}
+	p := New(testLogger, client, WithTimeout(50*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.IsHealthy(context.Background(), newMockPod("192.168.100.1"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the probe to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("probe without deadline did not time out")
+	}
+}
+
+func TestGetPostgresStartTime(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		body          string
+		expected      time.Time
+		expectedError error
+	}{
+		{
+			subtest:  "start time with fraction",
+			body:     `{"state": "running", "role": "master", "postmaster_start_time": "2023-09-25 13:15:12.617045+00:00"}`,
+			expected: time.Date(2023, 9, 25, 13, 15, 12, 617045000, time.UTC),
+		},
+		{
+			subtest:  "start time without fraction",
+			body:     `{"state": "running", "role": "replica", "postmaster_start_time": "2023-09-25 15:15:12+02:00"}`,
+			expected: time.Date(2023, 9, 25, 13, 15, 12, 0, time.UTC),
+		},
+		{
+			subtest:       "start time not reported",
+			body:          `{"state": "stopped", "role": "uninitialized"}`,
+			expectedError: ErrNotSupported,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.body), nil
+		}}
+		p := New(testLogger, client)
+
+		started, err := p.GetPostgresStartTime(context.Background(), newMockPod("192.168.100.1"))
+		if tt.expectedError != nil {
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if !started.Equal(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.subtest, tt.expected, started)
+		}
+	}
+}
+
+func TestHealthScore(t *testing.T) {
+	pods := []*v1.Pod{
+		newMockNamedPod("acid-test-0", "10.0.0.1"),
+		newMockNamedPod("acid-test-1", "10.0.0.2"),
+		newMockNamedPod("acid-test-2", "10.0.0.3"),
+	}
+
+	var testTable = []struct {
+		subtest         string
+		statuses        map[string]string
+		options         []Option
+		expectedScore   int
+		expectedDetails HealthDetails
+	}{
+		{
+			subtest: "perfect cluster",
+			statuses: map[string]string{
+				"10.0.0.1": `{"state": "running", "role": "master", "xlog": {"location": 50331648}}`,
+				"10.0.0.2": `{"state": "running", "role": "replica", "xlog": {"replayed_location": 50331648}}`,
+				"10.0.0.3": `{"state": "running", "role": "replica", "xlog": {"replayed_location": 50331000}}`,
+			},
+			expectedScore:   100,
+			expectedDetails: HealthDetails{LeaderPresent: true, Replicas: 2, ExpectedReplicas: 2, MaxLagBytes: 648, Reachable: 3, Members: 3},
+		},
+		{
+			subtest: "degraded cluster",
+			statuses: map[string]string{
+				"10.0.0.1": `{"state": "running", "role": "master", "pending_restart": true, "xlog": {"location": 134217728}}`,
+				"10.0.0.2": `{"state": "running", "role": "replica", "xlog": {"replayed_location": 67108864}}`,
+			},
+			expectedScore:   69,
+			expectedDetails: HealthDetails{LeaderPresent: true, Replicas: 1, ExpectedReplicas: 2, MaxLagBytes: 67108864, PendingRestarts: 1, Reachable: 2, Members: 3},
+		},
+		{
+			subtest: "degraded cluster weighing only the leader",
+			statuses: map[string]string{
+				"10.0.0.1": `{"state": "running", "role": "master", "pending_restart": true, "xlog": {"location": 134217728}}`,
+				"10.0.0.2": `{"state": "running", "role": "replica", "xlog": {"replayed_location": 67108864}}`,
+			},
+			options:         []Option{WithHealthWeights(HealthWeights{Leader: 1})},
+			expectedScore:   100,
+			expectedDetails: HealthDetails{LeaderPresent: true, Replicas: 1, ExpectedReplicas: 2, MaxLagBytes: 67108864, PendingRestarts: 1, Reachable: 2, Members: 3},
+		},
+		{
+			subtest: "no leader",
+			statuses: map[string]string{
+				"10.0.0.2": `{"state": "running", "role": "replica"}`,
+				"10.0.0.3": `{"state": "running", "role": "replica"}`,
+			},
+			options:         []Option{WithHealthWeights(HealthWeights{Leader: 1})},
+			expectedScore:   0,
+			expectedDetails: HealthDetails{Replicas: 2, ExpectedReplicas: 2, Reachable: 2, Members: 3},
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			status, ok := tt.statuses[request.URL.Hostname()]
+			if !ok {
+				return nil, errors.New("connection refused")
+			}
+			return newMockResponse(http.StatusOK, status), nil
+		}}
+		p := New(testLogger, client, tt.options...)
+
+		score, details, err := p.HealthScore(context.Background(), pods)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if score != tt.expectedScore {
+			t.Errorf("%s: expected score %d, got %d", tt.subtest, tt.expectedScore, score)
+		}
+		if details != tt.expectedDetails {
+			t.Errorf("%s: expected details %+v, got %+v", tt.subtest, tt.expectedDetails, details)
+		}
+	}
+}
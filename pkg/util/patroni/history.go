@@ -0,0 +1,82 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// HistoryEntry is a timeline switch of the cluster, caused by a failover or
+// switchover. Timestamp and NewLeader are only reported by recent Patroni
+// versions and are zero otherwise.
+type HistoryEntry struct {
+	Timeline  int
+	LSN       int64
+	Reason    string
+	Timestamp time.Time
+	NewLeader string
+}
+
+// UnmarshalJSON decodes an entry of the /history endpoint, which is an array
+// of timeline, LSN, reason, timestamp and new leader
+func (e *HistoryEntry) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) < 3 {
+		return fmt.Errorf("history entry %s has %d fields, expected at least 3", data, len(fields))
+	}
+
+	var entry HistoryEntry
+	if err := json.Unmarshal(fields[0], &entry.Timeline); err != nil {
+		return fmt.Errorf("could not parse timeline: %v", err)
+	}
+	if err := json.Unmarshal(fields[1], &entry.LSN); err != nil {
+		return fmt.Errorf("could not parse LSN: %v", err)
+	}
+	if err := json.Unmarshal(fields[2], &entry.Reason); err != nil {
+		return fmt.Errorf("could not parse reason: %v", err)
+	}
+	if len(fields) > 3 {
+		var timestamp string
+		if err := json.Unmarshal(fields[3], &timestamp); err != nil {
+			return fmt.Errorf("could not parse timestamp: %v", err)
+		}
+		if timestamp != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, timestamp)
+			if err != nil {
+				return fmt.Errorf("could not parse timestamp: %v", err)
+			}
+			entry.Timestamp = parsed
+		}
+	}
+	if len(fields) > 4 {
+		if err := json.Unmarshal(fields[4], &entry.NewLeader); err != nil {
+			return fmt.Errorf("could not parse new leader: %v", err)
+		}
+	}
+	*e = entry
+	return nil
+}
+
+// GetHistory returns the timeline history of the cluster, oldest first
+func (p *Patroni) GetHistory(ctx context.Context, server *v1.Pod) ([]HistoryEntry, error) {
+	apiURLString, err := p.apiURL(server)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.httpGet(ctx, apiURLString+historyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []HistoryEntry
+	if err := json.Unmarshal([]byte(body), &history); err != nil {
+		return nil, fmt.Errorf("could not parse history: %v", err)
+	}
+	return history, nil
+}
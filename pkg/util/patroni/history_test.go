@@ -0,0 +1,71 @@
+package patroni
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetHistory(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		history       string
+		expected      []HistoryEntry
+		expectedError bool
+	}{
+		{
+			subtest: "all fields",
+			history: `[[1, 25623960, "no recovery target specified", "2021-02-19T14:31:50.123456+00:00", "acid-test-1"], [2, 25624400, "no recovery target specified", "2021-02-20T08:00:00+01:00", "acid-test-0"]]`,
+			expected: []HistoryEntry{
+				{Timeline: 1, LSN: 25623960, Reason: "no recovery target specified", Timestamp: time.Date(2021, 2, 19, 14, 31, 50, 123456000, time.UTC), NewLeader: "acid-test-1"},
+				{Timeline: 2, LSN: 25624400, Reason: "no recovery target specified", Timestamp: time.Date(2021, 2, 20, 7, 0, 0, 0, time.UTC), NewLeader: "acid-test-0"},
+			},
+		},
+		{
+			subtest: "old Patroni",
+			history: `[[1, 25623960, "no recovery target specified"], [2, 25624400, "no recovery target specified", "2021-02-19T14:31:50+00:00"]]`,
+			expected: []HistoryEntry{
+				{Timeline: 1, LSN: 25623960, Reason: "no recovery target specified"},
+				{Timeline: 2, LSN: 25624400, Reason: "no recovery target specified", Timestamp: time.Date(2021, 2, 19, 14, 31, 50, 0, time.UTC)},
+			},
+		},
+		{
+			subtest:  "no history",
+			history:  `[]`,
+			expected: []HistoryEntry{},
+		},
+		{
+			subtest:       "truncated entry",
+			history:       `[[1, 25623960]]`,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.URL.Path != historyPath {
+				t.Errorf("%s: unexpected request to %s", tt.subtest, request.URL.Path)
+			}
+			return newMockResponse(http.StatusOK, tt.history), nil
+		}}
+		p := New(testLogger, client)
+
+		history, err := p.GetHistory(context.Background(), newMockPod("192.168.100.1"))
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if len(history) != len(tt.expected) {
+			t.Fatalf("%s: expected %v, got %v", tt.subtest, tt.expected, history)
+		}
+		for i := range history {
+			if !history[i].Timestamp.Equal(tt.expected[i].Timestamp) {
+				t.Errorf("%s: expected timestamp %v, got %v", tt.subtest, tt.expected[i].Timestamp, history[i].Timestamp)
+			}
+			history[i].Timestamp = tt.expected[i].Timestamp
+			if !reflect.DeepEqual(history[i], tt.expected[i]) {
+				t.Errorf("%s: expected %#v, got %#v", tt.subtest, tt.expected[i], history[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Supported JSON patch operations
+const (
+	PatchAdd     = "add"
+	PatchRemove  = "remove"
+	PatchReplace = "replace"
+)
+
+// PatchOp is a single JSON patch (RFC 6902) operation. Path is a JSON
+// pointer into the dynamic configuration, e.g. "/postgresql/parameters/work_mem".
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ApplyJSONPatch applies the operations in order to the current dynamic
+// configuration and sends the difference to Patroni as a merge patch. Either
+// all operations apply or nothing is sent.
+func (p *Patroni) ApplyJSONPatch(ctx context.Context, server *v1.Pod, patch []PatchOp) error {
+	current, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return err
+	}
+	copied, err := normalizeJSON(current)
+	if err != nil {
+		return fmt.Errorf("could not copy config: %v", err)
+	}
+
+	var document interface{} = copied
+	for _, op := range patch {
+		if document, err = applyPatchOp(document, op); err != nil {
+			return fmt.Errorf("could not apply %s %s: %v", op.Op, op.Path, err)
+		}
+	}
+	desired, ok := document.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("patched config is not an object")
+	}
+
+	diff := mergePatch(current, desired)
+	if len(diff) == 0 {
+		return nil
+	}
+	return p.SetConfig(ctx, server, diff)
+}
+
+// EnsureConfig brings the dynamic configuration to the desired state and
+// tells whether it had to be changed. Keys not in desired are kept, a nil
+// value removes a key like in a merge patch. Only the differing keys are
+// sent to Patroni, nothing if the config is already as desired.
+func (p *Patroni) EnsureConfig(ctx context.Context, server *v1.Pod, desired map[string]interface{}) (bool, error) {
+	current, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return false, err
+	}
+	normalized, err := normalizeJSON(desired)
+	if err != nil {
+		return false, fmt.Errorf("could not encode desired config: %v", err)
+	}
+	normalizedMap, _ := normalized.(map[string]interface{})
+
+	diff := minimalMergePatch(current, normalizedMap)
+	if len(diff) == 0 {
+		return false, nil
+	}
+	if err := p.SetConfig(ctx, server, diff); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// normalizeJSON converts a value into the types produced by decoding JSON, so
+// it can be compared with decoded values. The result shares no maps or slices
+// with the input.
+func normalizeJSON(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parsePointer splits a JSON pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q does not start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func applyPatchOp(document interface{}, op PatchOp) (interface{}, error) {
+	switch op.Op {
+	case PatchAdd, PatchRemove, PatchReplace:
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := normalizeJSON(op.Value)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode value: %v", err)
+	}
+	return applyAt(document, tokens, op.Op, value)
+}
+
+// applyAt applies the operation at the location given by tokens below node
+// and returns the modified node
+func applyAt(node interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		if op == PatchRemove {
+			return nil, fmt.Errorf("cannot remove the whole config")
+		}
+		return value, nil
+	}
+	token, last := tokens[0], len(tokens) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, exists := n[token]
+		if !last {
+			if !exists {
+				return nil, fmt.Errorf("key %q does not exist", token)
+			}
+			updated, err := applyAt(child, tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[token] = updated
+			return n, nil
+		}
+		if op != PatchAdd && !exists {
+			return nil, fmt.Errorf("key %q does not exist", token)
+		}
+		if op == PatchRemove {
+			delete(n, token)
+		} else {
+			n[token] = value
+		}
+		return n, nil
+
+	case []interface{}:
+		if last && op == PatchAdd && token == "-" {
+			return append(n, value), nil
+		}
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index > len(n) || (index == len(n) && !(last && op == PatchAdd)) {
+			return nil, fmt.Errorf("invalid array index %q", token)
+		}
+		if !last {
+			updated, err := applyAt(n[index], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[index] = updated
+			return n, nil
+		}
+		switch op {
+		case PatchAdd:
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+		case PatchRemove:
+			n = append(n[:index], n[index+1:]...)
+		default:
+			n[index] = value
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot address %q in a scalar value", token)
+}
+
+// mergePatch returns the merge patch (RFC 7386) turning current into desired:
+// removed keys are set to null, nested objects are diffed recursively and all
+// other changed values, including arrays, are replaced
+func mergePatch(current, desired map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for key := range current {
+		if _, ok := desired[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, value := range desired {
+		old, ok := current[key]
+		oldMap, oldIsMap := old.(map[string]interface{})
+		newMap, newIsMap := value.(map[string]interface{})
+		switch {
+		case ok && oldIsMap && newIsMap:
+			if nested := mergePatch(oldMap, newMap); len(nested) > 0 {
+				patch[key] = nested
+			}
+		case !ok || !reflect.DeepEqual(old, value):
+			patch[key] = value
+		}
+	}
+	return patch
+}
+
+// minimalMergePatch returns the merge patch applying desired to current,
+// leaving out keys which already have the desired value. Unlike mergePatch
+// keys missing in desired are kept.
+func minimalMergePatch(current, desired map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for key, value := range desired {
+		old, ok := current[key]
+		oldMap, oldIsMap := old.(map[string]interface{})
+		newMap, newIsMap := value.(map[string]interface{})
+		switch {
+		case value == nil:
+			if ok {
+				patch[key] = nil
+			}
+		case ok && oldIsMap && newIsMap:
+			if nested := minimalMergePatch(oldMap, newMap); len(nested) > 0 {
+				patch[key] = nested
+			}
+		case !ok || !reflect.DeepEqual(old, value):
+			patch[key] = value
+		}
+	}
+	return patch
+}
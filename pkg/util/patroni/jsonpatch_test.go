@@ -0,0 +1,190 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	config := `{"ttl": 30, "postgresql": {"parameters": {"work_mem": "4MB", "max_connections": 100}}, "slots": {"logical_a": {"type": "logical"}}}`
+
+	var testTable = []struct {
+		subtest       string
+		patch         []PatchOp
+		expected      map[string]interface{}
+		expectedError bool
+	}{
+		{
+			subtest: "add parameter",
+			patch:   []PatchOp{{Op: PatchAdd, Path: "/postgresql/parameters/shared_buffers", Value: "1GB"}},
+			expected: map[string]interface{}{
+				"postgresql": map[string]interface{}{"parameters": map[string]interface{}{"shared_buffers": "1GB"}},
+			},
+		},
+		{
+			subtest: "remove one slot while adding another",
+			patch: []PatchOp{
+				{Op: PatchRemove, Path: "/slots/logical_a"},
+				{Op: PatchAdd, Path: "/slots/logical_b", Value: map[string]string{"type": "logical"}},
+			},
+			expected: map[string]interface{}{
+				"slots": map[string]interface{}{"logical_a": nil, "logical_b": map[string]interface{}{"type": "logical"}},
+			},
+		},
+		{
+			subtest: "replace value",
+			patch:   []PatchOp{{Op: PatchReplace, Path: "/ttl", Value: 20}},
+			expected: map[string]interface{}{
+				"ttl": float64(20),
+			},
+		},
+		{
+			subtest: "replace with unchanged value",
+			patch:   []PatchOp{{Op: PatchReplace, Path: "/postgresql/parameters/max_connections", Value: 100}},
+		},
+		{
+			subtest:       "replace missing key",
+			patch:         []PatchOp{{Op: PatchReplace, Path: "/loop_wait", Value: 10}},
+			expectedError: true,
+		},
+		{
+			subtest: "failed operation discards earlier ones",
+			patch: []PatchOp{
+				{Op: PatchReplace, Path: "/ttl", Value: 20},
+				{Op: PatchRemove, Path: "/slots/logical_b"},
+			},
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		var patched map[string]interface{}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodPatch {
+				body, _ := ioutil.ReadAll(request.Body)
+				if err := json.Unmarshal(body, &patched); err != nil {
+					t.Fatalf("%s: could not decode patch: %v", tt.subtest, err)
+				}
+			}
+			return newMockResponse(http.StatusOK, config), nil
+		}}
+		p := New(testLogger, client)
+
+		err := p.ApplyJSONPatch(context.Background(), newMockPod("192.168.100.1"), tt.patch)
+		if tt.expectedError {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.subtest)
+			}
+			if patched != nil {
+				t.Errorf("%s: expected no patch to be sent, got %v", tt.subtest, patched)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if !reflect.DeepEqual(patched, tt.expected) {
+			t.Errorf("%s: expected patch %v, got %v", tt.subtest, tt.expected, patched)
+		}
+	}
+}
+
+func TestApplyPatchOpArrays(t *testing.T) {
+	document := map[string]interface{}{"pg_hba": []interface{}{"local all all trust", "host all all 0.0.0.0/0 md5"}}
+
+	var result interface{} = document
+	var err error
+	for _, op := range []PatchOp{
+		{Op: PatchAdd, Path: "/pg_hba/0", Value: "hostssl all all 0.0.0.0/0 md5"},
+		{Op: PatchRemove, Path: "/pg_hba/2"},
+		{Op: PatchAdd, Path: "/pg_hba/-", Value: "host replication standby all md5"},
+	} {
+		if result, err = applyPatchOp(result, op); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := map[string]interface{}{"pg_hba": []interface{}{
+		"hostssl all all 0.0.0.0/0 md5",
+		"local all all trust",
+		"host replication standby all md5",
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestEnsureConfig(t *testing.T) {
+	config := `{"ttl": 30, "loop_wait": 10, "postgresql": {"parameters": {"work_mem": "4MB", "max_connections": 100}}}`
+
+	var testTable = []struct {
+		subtest         string
+		desired         map[string]interface{}
+		expectedChanged bool
+		expectedPatch   map[string]interface{}
+	}{
+		{
+			subtest: "no change",
+			desired: map[string]interface{}{
+				"ttl":        30,
+				"postgresql": map[string]interface{}{"parameters": map[string]interface{}{"max_connections": 100}},
+			},
+		},
+		{
+			subtest: "additive change",
+			desired: map[string]interface{}{
+				"ttl":        30,
+				"postgresql": map[string]interface{}{"parameters": map[string]string{"shared_buffers": "1GB"}},
+			},
+			expectedChanged: true,
+			expectedPatch: map[string]interface{}{
+				"postgresql": map[string]interface{}{"parameters": map[string]interface{}{"shared_buffers": "1GB"}},
+			},
+		},
+		{
+			subtest: "value change",
+			desired: map[string]interface{}{
+				"ttl":        20,
+				"postgresql": map[string]interface{}{"parameters": map[string]interface{}{"work_mem": "4MB", "max_connections": 200}},
+			},
+			expectedChanged: true,
+			expectedPatch: map[string]interface{}{
+				"ttl":        float64(20),
+				"postgresql": map[string]interface{}{"parameters": map[string]interface{}{"max_connections": float64(200)}},
+			},
+		},
+		{
+			subtest:         "removal",
+			desired:         map[string]interface{}{"loop_wait": nil, "retry_timeout": nil},
+			expectedChanged: true,
+			expectedPatch:   map[string]interface{}{"loop_wait": nil},
+		},
+	}
+	for _, tt := range testTable {
+		var patched map[string]interface{}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodPatch {
+				body, _ := ioutil.ReadAll(request.Body)
+				if err := json.Unmarshal(body, &patched); err != nil {
+					t.Fatalf("%s: could not decode patch: %v", tt.subtest, err)
+				}
+			}
+			return newMockResponse(http.StatusOK, config), nil
+		}}
+		p := New(testLogger, client)
+
+		changed, err := p.EnsureConfig(context.Background(), newMockPod("192.168.100.1"), tt.desired)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if changed != tt.expectedChanged {
+			t.Errorf("%s: expected changed %t, got %t", tt.subtest, tt.expectedChanged, changed)
+		}
+		if !reflect.DeepEqual(patched, tt.expectedPatch) {
+			t.Errorf("%s: expected patch %v, got %v", tt.subtest, tt.expectedPatch, patched)
+		}
+	}
+}
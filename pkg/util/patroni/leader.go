@@ -0,0 +1,126 @@
+package patroni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// NotLeaderError is returned when an operation which requires the leader is
+// sent to another member. Leader is empty if the cluster has no leader.
+type NotLeaderError struct {
+	Member string
+	Leader string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.Leader == "" {
+		return fmt.Sprintf("%s is not the leader, the cluster has no leader", e.Member)
+	}
+	return fmt.Sprintf("%s is not the leader, current leader is %s", e.Member, e.Leader)
+}
+
+// Is makes errors.Is(err, ErrNotLeader) match a NotLeaderError
+func (e *NotLeaderError) Is(target error) bool {
+	return target == ErrNotLeader
+}
+
+// checkLeader verifies the pod is the leader when the client requires it
+func (p *Patroni) checkLeader(ctx context.Context, server *v1.Pod) error {
+	if !p.requireLeader {
+		return nil
+	}
+	return p.verifyLeader(ctx, server)
+}
+
+// verifyLeader returns a NotLeaderError unless the pod is the leader
+func (p *Patroni) verifyLeader(ctx context.Context, server *v1.Pod) error {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return fmt.Errorf("could not verify %s is the leader: %v", server.Name, err)
+	}
+	if data.IsLeader() {
+		return nil
+	}
+
+	leader, err := p.getLeaderName(ctx, server)
+	if err != nil {
+		return fmt.Errorf("could not find leader of %s: %v", server.Name, err)
+	}
+	return &NotLeaderError{Member: server.Name, Leader: leader}
+}
+
+// getLeaderName reads the name of the current leader from the cluster view
+func (p *Patroni) getLeaderName(ctx context.Context, server *v1.Pod) (string, error) {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return "", err
+	}
+	for _, member := range cluster.Members {
+		if member.isLeader() {
+			return member.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// SwitchoverToAny performs a planned switchover like Switchover without a
+// candidate, Patroni picks the healthiest replica and refuses when there is
+// none. The former leader keeps running as a replica of the new one. It is
+// only sent to the current leader.
+func (p *Patroni) SwitchoverToAny(ctx context.Context, server *v1.Pod) error {
+	if err := p.verifyLeader(ctx, server); err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]string{"leader": server.Name})
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	return p.call(ctx, server, opSwitchover, buf)
+}
+
+// WaitForClusterLocked polls the member until it reports that a leader holds
+// the cluster lock, e.g. after a failover or restart
+func (p *Patroni) WaitForClusterLocked(ctx context.Context, server *v1.Pod, timeout time.Duration) error {
+	deadline := p.clock.Now().Add(timeout)
+	for {
+		data, err := p.GetMemberData(ctx, server)
+		if err == nil && !data.ClusterUnlocked {
+			return nil
+		}
+		if p.clock.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("cluster of %s not locked within %v, last error: %v", server.Name, timeout, err)
+			}
+			return fmt.Errorf("cluster of %s not locked within %v, member is %q with role %q", server.Name, timeout, data.State, data.Role)
+		}
+		if err := sleep(ctx, p.pollInterval); err != nil {
+			return fmt.Errorf("cluster of %s not locked: %v", server.Name, err)
+		}
+	}
+}
+
+// LeaderMakingProgress samples the WAL location of the leader twice, interval
+// apart, and tells whether it advanced, which shows the leader is writing.
+// False is inconclusive: an idle cluster writes no WAL either, so it should
+// only be taken as a sign of a stuck leader together with other symptoms,
+// e.g. clients timing out.
+func (p *Patroni) LeaderMakingProgress(ctx context.Context, server *v1.Pod, interval time.Duration) (bool, error) {
+	before, err := p.GetPrimaryLSN(ctx, server)
+	if err != nil {
+		return false, err
+	}
+	if err := sleep(ctx, interval); err != nil {
+		return false, err
+	}
+	after, err := p.GetPrimaryLSN(ctx, server)
+	if err != nil {
+		return false, err
+	}
+	return after > before, nil
+}
@@ -0,0 +1,202 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequireLeader(t *testing.T) {
+	cluster := `{"members": [{"name": "acid-test-0", "role": "leader", "state": "running"}, {"name": "acid-test-1", "role": "replica", "state": "running"}]}`
+
+	var testTable = []struct {
+		subtest string
+		pod     string
+		status  string
+		leader  string
+	}{
+		{
+			subtest: "leader target",
+			pod:     "acid-test-0",
+			status:  `{"state": "running", "role": "master"}`,
+		},
+		{
+			subtest: "replica target",
+			pod:     "acid-test-1",
+			status:  `{"state": "running", "role": "replica"}`,
+			leader:  "acid-test-0",
+		},
+	}
+	for _, tt := range testTable {
+		var patches int
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			switch {
+			case request.Method == http.MethodPatch:
+				patches++
+				return newMockResponse(http.StatusOK, "{}"), nil
+			case request.URL.Path == clusterPath:
+				return newMockResponse(http.StatusOK, cluster), nil
+			}
+			return newMockResponse(http.StatusOK, tt.status), nil
+		}}
+		p := New(testLogger, client, WithRequireLeader())
+
+		err := p.SetConfig(context.Background(), newMockNamedPod(tt.pod, "192.168.100.1"), map[string]interface{}{"ttl": 30})
+		if tt.leader == "" {
+			if err != nil || patches != 1 {
+				t.Errorf("%s: expected config to be patched, got %d patches and error %v", tt.subtest, patches, err)
+			}
+			continue
+		}
+
+		var notLeader *NotLeaderError
+		if !errors.As(err, &notLeader) || !errors.Is(err, ErrNotLeader) {
+			t.Fatalf("%s: expected a NotLeaderError, got %v", tt.subtest, err)
+		}
+		if notLeader.Leader != tt.leader {
+			t.Errorf("%s: expected leader %s in error, got %s", tt.subtest, tt.leader, notLeader.Leader)
+		}
+		if patches != 0 {
+			t.Errorf("%s: expected no config patch, got %d", tt.subtest, patches)
+		}
+	}
+}
+
+func TestSwitchoverToAny(t *testing.T) {
+	cluster := `{"members": [{"name": "acid-test-0", "role": "leader", "state": "running"}, {"name": "acid-test-1", "role": "replica", "state": "running"}]}`
+
+	var testTable = []struct {
+		subtest      string
+		pod          string
+		status       string
+		expectedBody string
+	}{
+		{
+			subtest:      "leader",
+			pod:          "acid-test-0",
+			status:       `{"state": "running", "role": "master"}`,
+			expectedBody: "{\"leader\":\"acid-test-0\"}\n",
+		},
+		{
+			subtest: "replica",
+			pod:     "acid-test-1",
+			status:  `{"state": "running", "role": "replica"}`,
+		},
+	}
+	for _, tt := range testTable {
+		var body string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			switch {
+			case request.Method == http.MethodPost && request.URL.Path == switchoverPath:
+				content, err := ioutil.ReadAll(request.Body)
+				body = string(content)
+				return newMockResponse(http.StatusOK, "Successfully switched over"), err
+			case request.URL.Path == clusterPath:
+				return newMockResponse(http.StatusOK, cluster), nil
+			}
+			return newMockResponse(http.StatusOK, tt.status), nil
+		}}
+		p := New(testLogger, client)
+
+		err := p.SwitchoverToAny(context.Background(), newMockNamedPod(tt.pod, "192.168.100.1"))
+		if tt.expectedBody == "" {
+			if !errors.Is(err, ErrNotLeader) || body != "" {
+				t.Errorf("%s: expected switchover to be rejected, got body %q and error %v", tt.subtest, body, err)
+			}
+			continue
+		}
+		if err != nil || body != tt.expectedBody {
+			t.Errorf("%s: expected body %q, got %q with error %v", tt.subtest, tt.expectedBody, body, err)
+		}
+	}
+}
+
+func TestWaitForClusterLocked(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		unlockedReads int
+		timeout       time.Duration
+		expectedError bool
+	}{
+		{
+			subtest:       "leader elected after unlocked reads",
+			unlockedReads: 3,
+			timeout:       time.Hour,
+		},
+		{
+			subtest:       "cluster stays unlocked",
+			unlockedReads: 1000000,
+			timeout:       time.Hour,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		reads := 0
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			reads++
+			if reads <= tt.unlockedReads {
+				return newMockResponse(http.StatusOK, `{"state": "running", "role": "replica", "cluster_unlocked": true}`), nil
+			}
+			return newMockResponse(http.StatusOK, `{"state": "running", "role": "replica"}`), nil
+		}}
+		clock := &fakeClock{now: time.Date(2021, 2, 19, 14, 0, 0, 0, time.UTC), step: time.Minute}
+		p := New(testLogger, client, WithClock(clock), WithPollInterval(0))
+
+		err := p.WaitForClusterLocked(context.Background(), newMockNamedPod("acid-test-1", "192.168.100.1"), tt.timeout)
+		if tt.expectedError {
+			if err == nil || !strings.Contains(err.Error(), `"running" with role "replica"`) {
+				t.Errorf("%s: expected error reporting the last state, got %v", tt.subtest, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if reads != tt.unlockedReads+1 {
+			t.Errorf("%s: expected %d reads, got %d", tt.subtest, tt.unlockedReads+1, reads)
+		}
+	}
+}
+
+func TestLeaderMakingProgress(t *testing.T) {
+	var testTable = []struct {
+		subtest   string
+		locations []int64
+		expected  bool
+	}{
+		{
+			subtest:   "writing leader",
+			locations: []int64{55978296057856, 55978296061952},
+			expected:  true,
+		},
+		{
+			subtest:   "idle or stuck leader",
+			locations: []int64{55978296057856, 55978296057856},
+		},
+	}
+	for _, tt := range testTable {
+		var polls int
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			location := tt.locations[polls]
+			polls++
+			return newMockResponse(http.StatusOK, fmt.Sprintf(`{"state": "running", "role": "master", "xlog": {"location": %d}}`, location)), nil
+		}}
+		p := New(testLogger, client)
+
+		progress, err := p.LeaderMakingProgress(context.Background(), newMockPod("192.168.100.1"), time.Millisecond)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if progress != tt.expected {
+			t.Errorf("%s: expected progress %t, got %t", tt.subtest, tt.expected, progress)
+		}
+		if polls != 2 {
+			t.Errorf("%s: expected 2 samples, got %d", tt.subtest, polls)
+		}
+	}
+}
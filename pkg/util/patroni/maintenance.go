@@ -0,0 +1,125 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ErrUnsafeOperation is returned when an operation would leave the cluster
+// without a healthy leader
+var ErrUnsafeOperation = errors.New("operation is unsafe for the cluster")
+
+// PauseFailoverFor puts the cluster into maintenance mode, which disables
+// automatic failover, and returns a function to resume it. Callers should
+// defer the returned function, so failover is re-enabled even on panic. If
+// resume is not called within the given duration a warning is logged, the
+// cluster stays paused though. Resuming does not use ctx, so it works after
+// ctx was cancelled. If the cluster is already paused, e.g. for a manual
+// maintenance, nothing is sent and resume leaves it paused.
+func (p *Patroni) PauseFailoverFor(ctx context.Context, server *v1.Pod, d time.Duration) (resume func() error, err error) {
+	paused, err := p.IsPaused(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	if paused {
+		return func() error { return nil }, nil
+	}
+	if err := p.SetConfig(ctx, server, map[string]interface{}{"pause": true}); err != nil {
+		return nil, err
+	}
+
+	timer := time.AfterFunc(d, func() {
+		if p.logger != nil {
+			p.logger.Warningf("failover of the cluster of %s is still paused after %v", server.Name, d)
+		}
+	})
+
+	var once sync.Once
+	resume = func() error {
+		var resumeErr error
+		once.Do(func() {
+			timer.Stop()
+			resumeErr = p.SetConfig(context.Background(), server, map[string]interface{}{"pause": false})
+		})
+		return resumeErr
+	}
+	return resume, nil
+}
+
+// Pause puts the cluster into maintenance mode. Nothing is sent if it is
+// already paused, unless the client was created WithoutPauseCheck.
+func (p *Patroni) Pause(ctx context.Context, server *v1.Pod) error {
+	return p.setPause(ctx, server, true)
+}
+
+// Resume ends the maintenance mode of the cluster. Nothing is sent if it is
+// not paused, unless the client was created WithoutPauseCheck.
+func (p *Patroni) Resume(ctx context.Context, server *v1.Pod) error {
+	return p.setPause(ctx, server, false)
+}
+
+// SetMaintenanceMode pauses or resumes the cluster like Pause and Resume
+func (p *Patroni) SetMaintenanceMode(ctx context.Context, server *v1.Pod, paused bool) error {
+	return p.setPause(ctx, server, paused)
+}
+
+// IsPaused tells whether the cluster is in maintenance mode. A config
+// without the pause flag is not paused.
+func (p *Patroni) IsPaused(ctx context.Context, server *v1.Pod) (bool, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return false, err
+	}
+	paused, _ := config["pause"].(bool)
+	return paused, nil
+}
+
+// setPause patches the pause flag, after reading the current flag to avoid
+// bumping the config version needlessly
+func (p *Patroni) setPause(ctx context.Context, server *v1.Pod, paused bool) error {
+	if !p.skipPauseCheck {
+		current, err := p.IsPaused(ctx, server)
+		if err != nil {
+			return err
+		}
+		if current == paused {
+			return nil
+		}
+	}
+	return p.SetConfig(ctx, server, map[string]interface{}{"pause": paused})
+}
+
+// CanStopPatroni checks whether Patroni, and with it Postgres, can be stopped
+// on a node taken out of service, e.g. by terminating its pod. It returns
+// ErrUnsafeOperation if the member is the only healthy leader, i.e. no
+// streaming replica eligible for failover could take over.
+func (p *Patroni) CanStopPatroni(ctx context.Context, server *v1.Pod) error {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return err
+	}
+
+	var isLeader, found bool
+	successors := 0
+	for _, member := range cluster.Members {
+		if member.Name == server.Name {
+			found, isLeader = true, member.isLeader()
+			continue
+		}
+		if !member.isLeader() && (member.State == "streaming" || member.State == "running") && failoverPriority(member.Tags) > 0 {
+			successors++
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s is not a member of the cluster", server.Name)
+	}
+	if isLeader && successors == 0 {
+		return fmt.Errorf("%s is the leader and no replica could take over: %w", server.Name, ErrUnsafeOperation)
+	}
+	return nil
+}
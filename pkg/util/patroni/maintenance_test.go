@@ -0,0 +1,232 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPauseFailoverFor(t *testing.T) {
+	var testTable = []struct {
+		subtest         string
+		config          string
+		expectedPatches []interface{}
+	}{
+		{
+			subtest:         "running cluster",
+			config:          `{"ttl": 30}`,
+			expectedPatches: []interface{}{true, false},
+		},
+		{
+			subtest: "cluster paused for maintenance",
+			config:  `{"ttl": 30, "pause": true}`,
+		},
+	}
+	for _, tt := range testTable {
+		var patches []interface{}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodGet {
+				return newMockResponse(http.StatusOK, tt.config), nil
+			}
+			var body map[string]interface{}
+			if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			patches = append(patches, body["pause"])
+			return newMockResponse(http.StatusOK, "{}"), nil
+		}}
+		p := New(nil, client)
+
+		resume, err := p.PauseFailoverFor(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), time.Minute)
+		if err != nil {
+			t.Fatalf("%s: could not pause failover: %v", tt.subtest, err)
+		}
+		if len(tt.expectedPatches) > 0 && !reflect.DeepEqual(patches, tt.expectedPatches[:1]) {
+			t.Fatalf("%s: expected pause to be set, got %v", tt.subtest, patches)
+		}
+
+		if err := resume(); err != nil {
+			t.Fatalf("%s: could not resume failover: %v", tt.subtest, err)
+		}
+		if err := resume(); err != nil {
+			t.Fatalf("%s: could not resume failover twice: %v", tt.subtest, err)
+		}
+		if !reflect.DeepEqual(patches, tt.expectedPatches) {
+			t.Errorf("%s: expected patches %v, got %v", tt.subtest, tt.expectedPatches, patches)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	var testTable = []struct {
+		subtest         string
+		config          string
+		resume          bool
+		options         []Option
+		expectedPatches []interface{}
+	}{
+		{
+			subtest:         "pause running cluster",
+			config:          `{"ttl": 30}`,
+			expectedPatches: []interface{}{true},
+		},
+		{
+			subtest: "pause paused cluster",
+			config:  `{"ttl": 30, "pause": true}`,
+		},
+		{
+			subtest:         "resume paused cluster",
+			config:          `{"ttl": 30, "pause": true}`,
+			resume:          true,
+			expectedPatches: []interface{}{false},
+		},
+		{
+			subtest: "resume running cluster",
+			config:  `{"ttl": 30}`,
+			resume:  true,
+		},
+		{
+			subtest:         "pause paused cluster without check",
+			config:          `{"ttl": 30, "pause": true}`,
+			options:         []Option{WithoutPauseCheck()},
+			expectedPatches: []interface{}{true},
+		},
+	}
+	for _, tt := range testTable {
+		var reads int
+		var patches []interface{}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodGet {
+				reads++
+				return newMockResponse(http.StatusOK, tt.config), nil
+			}
+			var body map[string]interface{}
+			if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			patches = append(patches, body["pause"])
+			return newMockResponse(http.StatusOK, "{}"), nil
+		}}
+		p := New(testLogger, client, tt.options...)
+
+		pod := newMockNamedPod("acid-test-0", "192.168.100.1")
+		var err error
+		if tt.resume {
+			err = p.Resume(context.Background(), pod)
+		} else {
+			err = p.Pause(context.Background(), pod)
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if !reflect.DeepEqual(patches, tt.expectedPatches) {
+			t.Errorf("%s: expected patches %v, got %v", tt.subtest, tt.expectedPatches, patches)
+		}
+		if skipped := len(tt.options) > 0; skipped != (reads == 0) {
+			t.Errorf("%s: unexpected number of config reads %d", tt.subtest, reads)
+		}
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	var testTable = []struct {
+		subtest  string
+		config   string
+		expected bool
+	}{
+		{
+			subtest:  "paused",
+			config:   `{"ttl": 30, "pause": true}`,
+			expected: true,
+		},
+		{
+			subtest: "resumed",
+			config:  `{"ttl": 30, "pause": false}`,
+		},
+		{
+			subtest: "no pause flag",
+			config:  `{"ttl": 30}`,
+		},
+	}
+	for _, tt := range testTable {
+		config := tt.config
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodPatch {
+				var patch map[string]interface{}
+				if err := json.NewDecoder(request.Body).Decode(&patch); err != nil {
+					return nil, err
+				}
+				config = fmt.Sprintf(`{"ttl": 30, "pause": %t}`, patch["pause"])
+			}
+			return newMockResponse(http.StatusOK, config), nil
+		}}
+		p := New(testLogger, client)
+		pod := newMockPod("192.168.100.1")
+
+		paused, err := p.IsPaused(context.Background(), pod)
+		if err != nil || paused != tt.expected {
+			t.Errorf("%s: expected paused %t, got %t %v", tt.subtest, tt.expected, paused, err)
+		}
+		if err := p.SetMaintenanceMode(context.Background(), pod, !tt.expected); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if paused, _ := p.IsPaused(context.Background(), pod); paused == tt.expected {
+			t.Errorf("%s: expected maintenance mode to be toggled", tt.subtest)
+		}
+	}
+}
+
+func TestCanStopPatroni(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		member        string
+		cluster       string
+		expectedError error
+	}{
+		{
+			subtest: "replica",
+			member:  "acid-test-1",
+			cluster: `{"members": [
+				{"name": "acid-test-0", "role": "leader", "state": "running"},
+				{"name": "acid-test-1", "role": "replica", "state": "streaming"}
+			]}`,
+		},
+		{
+			subtest: "leader with a successor",
+			member:  "acid-test-0",
+			cluster: `{"members": [
+				{"name": "acid-test-0", "role": "leader", "state": "running"},
+				{"name": "acid-test-1", "role": "replica", "state": "streaming"}
+			]}`,
+		},
+		{
+			subtest: "only healthy leader",
+			member:  "acid-test-0",
+			cluster: `{"members": [
+				{"name": "acid-test-0", "role": "leader", "state": "running"},
+				{"name": "acid-test-1", "role": "replica", "state": "stopped"},
+				{"name": "acid-test-2", "role": "replica", "state": "streaming", "tags": {"nofailover": true}}
+			]}`,
+			expectedError: ErrUnsafeOperation,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method != http.MethodGet {
+				t.Errorf("%s: unexpected %s request to %s", tt.subtest, request.Method, request.URL.Path)
+			}
+			return newMockResponse(http.StatusOK, tt.cluster), nil
+		}}
+		p := New(testLogger, client)
+
+		err := p.CanStopPatroni(context.Background(), newMockNamedPod(tt.member, "192.168.100.1"))
+		if !errors.Is(err, tt.expectedError) || (tt.expectedError == nil && err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ErrScopeMismatch is returned when a member belongs to another cluster
+var ErrScopeMismatch = errors.New("patroni scope mismatch")
+
+// MapMembersToPods correlates Patroni members with pods by name. It returns
+// the mapping, the sorted names of stale members without a pod and the
+// sorted names of orphan pods without a member, e.g. pods which are not yet
+// or no longer part of the cluster.
+func MapMembersToPods(members map[string]MemberData, pods []*v1.Pod) (map[string]*v1.Pod, []string, []string) {
+	mapping := make(map[string]*v1.Pod, len(members))
+	orphans := []string{}
+	for _, pod := range pods {
+		if _, ok := members[pod.Name]; !ok {
+			orphans = append(orphans, pod.Name)
+			continue
+		}
+		mapping[pod.Name] = pod
+	}
+	sort.Strings(orphans)
+
+	stale := []string{}
+	for name := range members {
+		if _, ok := mapping[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return mapping, stale, orphans
+}
+
+// RoleLabel is the default label the operator sets to the role of a pod
+const RoleLabel = "spilo-role"
+
+// ReconcileRoleLabels returns the role label, master or replica, for every
+// pod whose RoleLabel disagrees with the role Patroni reports, e.g. because
+// it is stale after a failover. A standby leader is labeled master like in
+// the operator. Pods without member data are skipped, their sorted names are
+// returned as well.
+func ReconcileRoleLabels(servers []*v1.Pod, members map[string]MemberData) (map[string]string, []string) {
+	labels := make(map[string]string)
+	skipped := []string{}
+	for _, pod := range servers {
+		data, ok := members[pod.Name]
+		if !ok {
+			skipped = append(skipped, pod.Name)
+			continue
+		}
+		role := "replica"
+		if data.IsLeader() || data.Role == "standby_leader" {
+			role = "master"
+		}
+		if pod.Labels[RoleLabel] != role {
+			labels[pod.Name] = role
+		}
+	}
+	sort.Strings(skipped)
+	return labels, skipped
+}
+
+// VerifyScope checks that the member belongs to the expected cluster, which
+// guards against operating on another cluster after a pod IP got reused
+func (p *Patroni) VerifyScope(ctx context.Context, server *v1.Pod, expectedScope string) error {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return err
+	}
+	if data.Patroni.Scope != expectedScope {
+		return fmt.Errorf("%w: %s belongs to %q instead of %q", ErrScopeMismatch, server.Name, data.Patroni.Scope, expectedScope)
+	}
+	return nil
+}
+
+// membersError combines the errors of several pods into one, nil if there
+// are none
+func membersError(errs map[string]error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("%s: %v", name, errs[name]))
+	}
+	return fmt.Errorf("could not query %d pods: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// PendingRestartReport returns, for every pod with a pending restart, the
+// parameters requiring it with their old and new values. The details are
+// empty for Patroni versions not reporting them. Pods which could not be
+// queried are left out and reported in the error.
+func (p *Patroni) PendingRestartReport(ctx context.Context, servers []*v1.Pod) (map[string]map[string]interface{}, error) {
+	members, errs := p.GetMembersData(ctx, servers)
+	report := make(map[string]map[string]interface{})
+	for name, data := range members {
+		if !data.PendingRestart {
+			continue
+		}
+		reasons := data.PendingRestartReason
+		if reasons == nil {
+			reasons = map[string]interface{}{}
+		}
+		report[name] = reasons
+	}
+	return report, membersError(errs)
+}
@@ -0,0 +1,147 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestMapMembersToPods(t *testing.T) {
+	pod0 := newMockNamedPod("acid-test-0", "10.0.0.1")
+	pod1 := newMockNamedPod("acid-test-1", "10.0.0.2")
+
+	var testTable = []struct {
+		subtest         string
+		members         map[string]MemberData
+		pods            []*v1.Pod
+		expectedMapping map[string]*v1.Pod
+		expectedStale   []string
+		expectedOrphans []string
+	}{
+		{
+			subtest:         "all matched",
+			members:         map[string]MemberData{"acid-test-0": {}, "acid-test-1": {}},
+			pods:            []*v1.Pod{pod0, pod1},
+			expectedMapping: map[string]*v1.Pod{"acid-test-0": pod0, "acid-test-1": pod1},
+			expectedStale:   []string{},
+			expectedOrphans: []string{},
+		},
+		{
+			subtest:         "stale member",
+			members:         map[string]MemberData{"acid-test-0": {}, "acid-test-2": {}},
+			pods:            []*v1.Pod{pod0},
+			expectedMapping: map[string]*v1.Pod{"acid-test-0": pod0},
+			expectedStale:   []string{"acid-test-2"},
+			expectedOrphans: []string{},
+		},
+		{
+			subtest:         "orphan pod",
+			members:         map[string]MemberData{"acid-test-0": {}},
+			pods:            []*v1.Pod{pod0, pod1},
+			expectedMapping: map[string]*v1.Pod{"acid-test-0": pod0},
+			expectedStale:   []string{},
+			expectedOrphans: []string{"acid-test-1"},
+		},
+	}
+	for _, tt := range testTable {
+		mapping, stale, orphans := MapMembersToPods(tt.members, tt.pods)
+		if !reflect.DeepEqual(mapping, tt.expectedMapping) {
+			t.Errorf("%s: expected mapping %v, got %v", tt.subtest, tt.expectedMapping, mapping)
+		}
+		if !reflect.DeepEqual(stale, tt.expectedStale) {
+			t.Errorf("%s: expected stale members %v, got %v", tt.subtest, tt.expectedStale, stale)
+		}
+		if !reflect.DeepEqual(orphans, tt.expectedOrphans) {
+			t.Errorf("%s: expected orphan pods %v, got %v", tt.subtest, tt.expectedOrphans, orphans)
+		}
+	}
+}
+
+func TestReconcileRoleLabels(t *testing.T) {
+	newLabeledPod := func(name string, role string) *v1.Pod {
+		pod := newMockNamedPod(name, "10.0.0.1")
+		pod.Labels = map[string]string{RoleLabel: role}
+		return pod
+	}
+	pods := []*v1.Pod{
+		// stale labels after a failover from acid-test-0 to acid-test-1
+		newLabeledPod("acid-test-0", "master"),
+		newLabeledPod("acid-test-1", "replica"),
+		newLabeledPod("acid-test-2", "replica"),
+		newMockNamedPod("acid-test-3", "10.0.0.4"),
+		newLabeledPod("acid-test-4", "replica"),
+	}
+	members := map[string]MemberData{
+		"acid-test-0": {Role: "replica"},
+		"acid-test-1": {Role: "master"},
+		"acid-test-2": {Role: "replica"},
+		"acid-test-3": {Role: "replica"},
+	}
+
+	labels, skipped := ReconcileRoleLabels(pods, members)
+	expected := map[string]string{"acid-test-0": "replica", "acid-test-1": "master", "acid-test-3": "replica"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, labels)
+	}
+	if !reflect.DeepEqual(skipped, []string{"acid-test-4"}) {
+		t.Errorf("expected acid-test-4 to be skipped, got %v", skipped)
+	}
+}
+
+func TestVerifyScope(t *testing.T) {
+	status := `{"state": "running", "role": "master", "patroni": {"version": "2.0.1", "scope": "acid-test"}}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, status), nil
+	}}
+	p := New(nil, client)
+	pod := newMockNamedPod("acid-test-0", "192.168.100.1")
+
+	if err := p.VerifyScope(context.Background(), pod, "acid-test"); err != nil {
+		t.Errorf("expected matching scope, got %v", err)
+	}
+	if err := p.VerifyScope(context.Background(), pod, "acid-other"); !errors.Is(err, ErrScopeMismatch) {
+		t.Errorf("expected ErrScopeMismatch, got %v", err)
+	}
+}
+
+func TestPendingRestartReport(t *testing.T) {
+	statuses := map[string]string{
+		"10.0.0.1": `{"state": "running", "role": "master", "pending_restart": true, "pending_restart_reason": {"max_connections": {"old_value": "100", "new_value": "200"}}}`,
+		"10.0.0.2": `{"state": "running", "role": "replica", "pending_restart": true, "pending_restart_reason": {"shared_buffers": {"old_value": "128MB", "new_value": "1GB"}}}`,
+		"10.0.0.3": `{"state": "running", "role": "replica"}`,
+		"10.0.0.4": `{"state": "running", "role": "replica", "pending_restart": true}`,
+	}
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		status, ok := statuses[request.URL.Hostname()]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		return newMockResponse(http.StatusOK, status), nil
+	}}
+	p := New(nil, client)
+	pods := []*v1.Pod{
+		newMockNamedPod("acid-test-0", "10.0.0.1"),
+		newMockNamedPod("acid-test-1", "10.0.0.2"),
+		newMockNamedPod("acid-test-2", "10.0.0.3"),
+		newMockNamedPod("acid-test-3", "10.0.0.4"),
+		newMockNamedPod("acid-test-4", "10.0.0.5"),
+	}
+
+	report, err := p.PendingRestartReport(context.Background(), pods)
+	if err == nil || !strings.Contains(err.Error(), "acid-test-4") {
+		t.Errorf("expected error for unreachable acid-test-4, got %v", err)
+	}
+	expected := map[string]map[string]interface{}{
+		"acid-test-0": {"max_connections": map[string]interface{}{"old_value": "100", "new_value": "200"}},
+		"acid-test-1": {"shared_buffers": map[string]interface{}{"old_value": "128MB", "new_value": "1GB"}},
+		"acid-test-3": {},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected report %v, got %v", expected, report)
+	}
+}
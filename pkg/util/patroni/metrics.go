@@ -0,0 +1,105 @@
+package patroni
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ClusterMetrics computes the health of the cluster from the member data of
+// the pods and renders it in the Prometheus text exposition format, so it is
+// available even if the metrics endpoint of Patroni is not. The replication
+// lag is only reported while there is a leader. An error is returned only if
+// no pod could be queried.
+func (p *Patroni) ClusterMetrics(ctx context.Context, servers []*v1.Pod) (string, error) {
+	members, errs := p.GetMembersData(ctx, servers)
+	if len(members) == 0 && len(errs) > 0 {
+		return "", membersError(errs)
+	}
+	details := summarizeHealth(members, len(servers))
+
+	var leaderPresent int64
+	if details.LeaderPresent {
+		leaderPresent = 1
+	}
+	var b strings.Builder
+	writeGauge(&b, "patroni_cluster_leader_present", "Whether a member holds the leader role.", leaderPresent)
+	writeGauge(&b, "patroni_cluster_replicas", "Number of running replicas.", int64(details.Replicas))
+	if details.LeaderPresent {
+		writeGauge(&b, "patroni_cluster_max_replication_lag_bytes", "Largest replay lag of a running replica behind the leader.", details.MaxLagBytes)
+	}
+	writeGauge(&b, "patroni_cluster_pending_restarts", "Number of members with a pending restart.", int64(details.PendingRestarts))
+	writeGauge(&b, "patroni_cluster_unreachable_members", "Number of members whose API could not be queried.", int64(details.Members-details.Reachable))
+	return b.String(), nil
+}
+
+func writeGauge(b *strings.Builder, name string, help string, value int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+// apiMetrics counts the calls of the Patroni API by path and status class
+// and their latency by path
+type apiMetrics struct {
+	requests  *prometheus.CounterVec
+	latencies *prometheus.HistogramVec
+}
+
+func newAPIMetrics() *apiMetrics {
+	return &apiMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "patroni_api_requests_total",
+			Help: "Number of Patroni API calls.",
+		}, []string{"path", "status_class"}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "patroni_api_request_duration_seconds",
+			Help:    "Latency of Patroni API calls.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path"}),
+	}
+}
+
+// statusClass groups HTTP statuses like 2xx, calls without response are
+// counted as "error"
+func statusClass(status int) string {
+	if status == 0 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+func (m *apiMetrics) observe(rawURL string, status int, latency time.Duration) {
+	path := "/"
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Path != "" {
+		path = parsed.Path
+	}
+	m.requests.WithLabelValues(path, statusClass(status)).Inc()
+	m.latencies.WithLabelValues(path).Observe(latency.Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (m *apiMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.latencies.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *apiMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.latencies.Collect(ch)
+}
+
+// APIMetrics returns a collector of the number of Patroni API calls by path
+// and status class and their latency by path, to be registered with a
+// Prometheus registry. It is nil unless the client was created
+// WithAPIMetrics.
+func (p *Patroni) APIMetrics() prometheus.Collector {
+	if p.metrics == nil {
+		return nil
+	}
+	return p.metrics
+}
@@ -0,0 +1,114 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestClusterMetrics(t *testing.T) {
+	statuses := map[string]string{
+		"10.0.0.1": `{"state": "running", "role": "master", "pending_restart": true, "xlog": {"location": 50331648}}`,
+		"10.0.0.2": `{"state": "running", "role": "replica", "xlog": {"replayed_location": 50331648}}`,
+		"10.0.0.3": `{"state": "running", "role": "replica", "pending_restart": true, "xlog": {"replayed_location": 33554432}}`,
+		"10.0.0.4": `{"state": "starting", "role": "replica"}`,
+	}
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		status, ok := statuses[request.URL.Hostname()]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		return newMockResponse(http.StatusOK, status), nil
+	}}
+	p := New(testLogger, client)
+	pods := []*v1.Pod{
+		newMockNamedPod("acid-test-0", "10.0.0.1"),
+		newMockNamedPod("acid-test-1", "10.0.0.2"),
+		newMockNamedPod("acid-test-2", "10.0.0.3"),
+		newMockNamedPod("acid-test-3", "10.0.0.4"),
+		newMockNamedPod("acid-test-4", "10.0.0.5"),
+	}
+
+	metrics, err := p.ClusterMetrics(context.Background(), pods)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, line := range []string{
+		"# TYPE patroni_cluster_leader_present gauge\npatroni_cluster_leader_present 1\n",
+		"\npatroni_cluster_replicas 2\n",
+		"\npatroni_cluster_max_replication_lag_bytes 16777216\n",
+		"\npatroni_cluster_pending_restarts 2\n",
+		"\npatroni_cluster_unreachable_members 1\n",
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, metrics)
+		}
+	}
+
+	metrics, err = p.ClusterMetrics(context.Background(), pods[1:2])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(metrics, "\npatroni_cluster_leader_present 0\n") || strings.Contains(metrics, "lag") {
+		t.Errorf("expected no leader and no lag, got:\n%s", metrics)
+	}
+
+	if _, err := p.ClusterMetrics(context.Background(), pods[4:]); err == nil {
+		t.Error("expected error when no member can be queried")
+	}
+}
+
+func TestAPIMetrics(t *testing.T) {
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		switch {
+		case request.URL.Path == "":
+			return nil, errors.New("connection reset by peer")
+		case request.Method == http.MethodPatch:
+			return newMockResponse(http.StatusConflict, "locked"), nil
+		}
+		return newMockResponse(http.StatusOK, "{}"), nil
+	}}
+	if collector := New(testLogger, client).APIMetrics(); collector != nil {
+		t.Errorf("expected no collector without the option, got %v", collector)
+	}
+	p := New(testLogger, client, WithAPIMetrics())
+	pod := newMockPod("192.168.100.1")
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.GetConfig(context.Background(), pod); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := p.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 30}); err == nil {
+		t.Fatal("expected an error for a locked cluster")
+	}
+	if _, err := p.GetMemberData(context.Background(), pod); err == nil {
+		t.Fatal("expected an error for a reset connection")
+	}
+
+	expected := `# HELP patroni_api_requests_total Number of Patroni API calls.
+# TYPE patroni_api_requests_total counter
+patroni_api_requests_total{path="/",status_class="error"} 1
+patroni_api_requests_total{path="/config",status_class="2xx"} 2
+patroni_api_requests_total{path="/config",status_class="4xx"} 1
+`
+	collector := p.APIMetrics()
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "patroni_api_requests_total"); err != nil {
+		t.Error(err)
+	}
+	// the latencies are not deterministic, only the histograms per path are
+	// counted
+	if count := testutil.CollectAndCount(collector, "patroni_api_request_duration_seconds"); count != 2 {
+		t.Errorf("expected latency histograms for 2 paths, got %d", count)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Errorf("could not register the collector: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package patroni
+
+import (
+	"crypto/tls"
+	"time"
+
+	httpclient "github.com/zalando/postgres-operator/pkg/util/httpclient"
+	"github.com/zalando/postgres-operator/pkg/util/ringlog"
+)
+
+// Option configures optional behaviour of the Patroni API client
+type Option func(*Patroni)
+
+// WithTraceBodies logs full request and response bodies of every call when
+// the logger is at trace level. Values of redacted keys are masked.
+func WithTraceBodies() Option {
+	return func(p *Patroni) {
+		p.traceBodies = true
+	}
+}
+
+// WithRedactedKeys adds JSON keys whose values are masked in logged bodies
+func WithRedactedKeys(keys ...string) Option {
+	return func(p *Patroni) {
+		redacted := make([]string, 0, len(p.redactedKeys)+len(keys))
+		redacted = append(redacted, p.redactedKeys...)
+		p.redactedKeys = append(redacted, keys...)
+	}
+}
+
+// WithClock replaces the clock used for time based decisions
+func WithClock(clock Clock) Option {
+	return func(p *Patroni) {
+		p.clock = clock
+	}
+}
+
+// WithClockSkewThreshold sets the skew above which CheckClockSkew warns
+func WithClockSkewThreshold(threshold time.Duration) Option {
+	return func(p *Patroni) {
+		p.clockSkewThreshold = threshold
+	}
+}
+
+// WithRequireLeader makes config-mutating calls verify that they are sent to
+// the leader and fail with a NotLeaderError otherwise
+func WithRequireLeader() Option {
+	return func(p *Patroni) {
+		p.requireLeader = true
+	}
+}
+
+// WithServerName sets the name used to verify the server certificate, so it
+// can be checked against the pod's DNS name even when connecting by IP. It
+// applies to the HTTP client created by New.
+func WithServerName(name string) Option {
+	return func(p *Patroni) {
+		if p.tlsConfig == nil {
+			p.tlsConfig = &tls.Config{}
+		}
+		p.tlsConfig.ServerName = name
+	}
+}
+
+// WithAPIMetrics counts the calls of the Patroni API and their latency, to
+// be exported with APIMetrics
+func WithAPIMetrics() Option {
+	return func(p *Patroni) {
+		p.metrics = newAPIMetrics()
+	}
+}
+
+// WithTraceBuffer keeps the last size operations in memory, to be inspected
+// with RecentOperations
+func WithTraceBuffer(size int) Option {
+	return func(p *Patroni) {
+		p.operations = ringlog.New(size)
+	}
+}
+
+// WithPollInterval sets the interval between reads while waiting for a
+// member or the cluster to reach a state
+func WithPollInterval(interval time.Duration) Option {
+	return func(p *Patroni) {
+		p.pollInterval = interval
+	}
+}
+
+// WithApplyTimeout sets how long VerifyParametersApplied waits for changes
+func WithApplyTimeout(timeout time.Duration) Option {
+	return func(p *Patroni) {
+		p.applyTimeout = timeout
+	}
+}
+
+// WithStrictDecode makes member data reads fail when Patroni reports fields
+// which are not modelled, to detect version drift. By default they are
+// ignored.
+func WithStrictDecode() Option {
+	return func(p *Patroni) {
+		p.strictDecode = true
+	}
+}
+
+// WithManagedSlots names permanent slots owned by the client, which
+// ReconcileSlots removes when they are no longer desired
+func WithManagedSlots(names ...string) Option {
+	return func(p *Patroni) {
+		for _, name := range names {
+			p.managedSlots[name] = true
+		}
+	}
+}
+
+// WithAPILatency records the round trip time of the status call in the
+// APILatency field of the member data
+func WithAPILatency() Option {
+	return func(p *Patroni) {
+		p.recordLatency = true
+	}
+}
+
+// WithMutableKeyAllowlist restricts SetConfig and SetPostgresParameters to
+// the given config keys, e.g. "ttl" or "postgresql.parameters". Patches
+// touching other keys are rejected before they are sent.
+func WithMutableKeyAllowlist(keys []string) Option {
+	return func(p *Patroni) {
+		p.mutableKeys = append([]string{}, keys...)
+	}
+}
+
+// WithMaxLoggedBodySize truncates traced request and response bodies to n
+// bytes, marking the cut with an ellipsis. Bodies are logged in full if n is
+// not positive.
+func WithMaxLoggedBodySize(n int) Option {
+	return func(p *Patroni) {
+		p.maxLoggedBodySize = n
+	}
+}
+
+// WithDialTimeout limits the time to establish a connection, so unreachable
+// pods fail fast while the overall request timeout stays unchanged. It
+// applies to the HTTP client created by New.
+func WithDialTimeout(d time.Duration) Option {
+	return func(p *Patroni) {
+		p.dialTimeout = d
+	}
+}
+
+// WithTLSConfig connects to the REST API over HTTPS using the given TLS
+// config, see NewTLSConfig, or the default one if it is nil. It applies to
+// the HTTP client created by New.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(p *Patroni) {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		serverName := ""
+		if p.tlsConfig != nil {
+			serverName = p.tlsConfig.ServerName
+		}
+		p.tlsConfig = config.Clone()
+		if p.tlsConfig.ServerName == "" {
+			p.tlsConfig.ServerName = serverName
+		}
+		p.scheme = "https"
+	}
+}
+
+// WithInsecureSkipVerify connects to the REST API over HTTPS without
+// verifying the server certificate, for self-signed setups. It applies to
+// the HTTP client created by New.
+func WithInsecureSkipVerify() Option {
+	return func(p *Patroni) {
+		if p.tlsConfig == nil {
+			p.tlsConfig = &tls.Config{}
+		}
+		p.tlsConfig.InsecureSkipVerify = true
+		p.scheme = "https"
+	}
+}
+
+// WithPinnedServerCert connects to the REST API over HTTPS and accepts only
+// the server certificate with the given hex SHA-256 fingerprint, colons
+// between the bytes are optional. The pin is checked in addition to the
+// verification against the CA, unless it is skipped WithInsecureSkipVerify.
+// It applies to the HTTP client created by New.
+func WithPinnedServerCert(sha256Fingerprint string) Option {
+	return func(p *Patroni) {
+		if p.tlsConfig == nil {
+			p.tlsConfig = &tls.Config{}
+		}
+		p.pinnedFingerprint = normalizeFingerprint(sha256Fingerprint)
+		p.scheme = "https"
+	}
+}
+
+// WithBasicAuth authenticates requests changing the cluster, i.e. all but
+// GET requests, with the given credentials, as required by Patroni's
+// restapi.authentication. The credentials are never logged.
+func WithBasicAuth(username, password string) Option {
+	return func(p *Patroni) {
+		p.username = username
+		p.password = password
+	}
+}
+
+// WithAuthenticatedReads sends the basic auth credentials with GET requests
+// too, for APIs protecting all endpoints
+func WithAuthenticatedReads() Option {
+	return func(p *Patroni) {
+		p.authenticateReads = true
+	}
+}
+
+// WithPort sets the port of the REST API, e.g. when restapi.listen is not
+// the default. Without it the container port named "patroni" is used if the
+// pod has one. Ports outside 1-65535 make every call fail.
+func WithPort(port int) Option {
+	return func(p *Patroni) {
+		p.port = port
+	}
+}
+
+// WithoutPauseCheck makes Pause and Resume send the pause flag without
+// reading the current one first
+func WithoutPauseCheck() Option {
+	return func(p *Patroni) {
+		p.skipPauseCheck = true
+	}
+}
+
+// WithRetryPolicy retries failed calls according to the policy, see
+// DefaultRetryPolicy. By default calls are not retried.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *Patroni) {
+		p.retryPolicy = policy
+	}
+}
+
+// WithHealthWeights changes how HealthScore weighs the aspects of health
+func WithHealthWeights(weights HealthWeights) Option {
+	return func(p *Patroni) {
+		p.healthWeights = weights
+	}
+}
+
+// WithIdempotencyKeys sends a random Idempotency-Key header with every POST
+// and PATCH request. Retries of a request repeat its key, so a proxy which
+// supports the header can drop duplicates.
+func WithIdempotencyKeys() Option {
+	return func(p *Patroni) {
+		p.idempotencyKeys = true
+	}
+}
+
+// WithLightweightMode makes Healthy probe the /liveness and /readiness
+// endpoints with a short timeout instead of reading and parsing the member
+// data, which keeps frequent health checks of many pods cheap
+func WithLightweightMode() Option {
+	return func(p *Patroni) {
+		p.lightweight = true
+	}
+}
+
+// WithPodDNSNames addresses pods by their name in the DNS of the headless
+// service given as subdomain, e.g. acid-test-0.acid-test.default.svc, which
+// is usable before the pod IP is reported. Pods without subdomain are
+// addressed by IP.
+func WithPodDNSNames() Option {
+	return func(p *Patroni) {
+		p.podDNSNames = true
+	}
+}
+
+// WithTimeout limits calls whose context has no deadline, 30 seconds by
+// default. Zero leaves them unlimited. A deadline of the context passed to a
+// call takes precedence, e.g. a short one for health checks or a long one
+// for a restart.
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Patroni) {
+		p.timeout = timeout
+	}
+}
+
+// WithHTTPClient sends requests with the given client instead of the one
+// passed to New. Transport options like WithTLSConfig do not apply to it.
+func WithHTTPClient(client httpclient.HTTPClient) Option {
+	return func(p *Patroni) {
+		p.httpClient = client
+	}
+}
+
+// WithScheme sets the scheme of the API URLs, "http" by default
+func WithScheme(scheme string) Option {
+	return func(p *Patroni) {
+		p.scheme = scheme
+	}
+}
@@ -0,0 +1,352 @@
+package patroni
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestWithServerName(t *testing.T) {
+	p := New(nil, nil, WithServerName("acid-test-0.acid-test.default.svc"))
+
+	client, ok := p.httpClient.(*http.Client)
+	if !ok {
+		t.Fatalf("expected an *http.Client, got %T", p.httpClient)
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig == nil {
+		t.Fatalf("expected a transport with TLS config, got %#v", client.Transport)
+	}
+	if name := transport.TLSClientConfig.ServerName; name != "acid-test-0.acid-test.default.svc" {
+		t.Errorf("expected TLS server name to be set, got %q", name)
+	}
+}
+
+func TestWithStrictDecode(t *testing.T) {
+	status := `{"state": "running", "role": "master", "unknown_field": 42}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, status), nil
+	}}
+
+	data, err := New(nil, client).GetMemberData(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil || data.Role != "master" {
+		t.Errorf("expected unknown field to be ignored, got %#v with error %v", data, err)
+	}
+
+	_, err = New(nil, client, WithStrictDecode()).GetMemberData(context.Background(), newMockPod("192.168.100.1"))
+	if err == nil || !strings.Contains(err.Error(), "unknown_field") {
+		t.Errorf("expected an error naming the unknown field, got %v", err)
+	}
+}
+
+func TestWithAPILatency(t *testing.T) {
+	delay := 5 * time.Millisecond
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		time.Sleep(delay)
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+	}}
+	pod := newMockNamedPod("acid-test-0", "192.168.100.1")
+
+	data, err := New(nil, client).GetMemberData(context.Background(), pod)
+	if err != nil || data.APILatency != 0 {
+		t.Errorf("expected no latency by default, got %v with error %v", data.APILatency, err)
+	}
+
+	p := New(nil, client, WithAPILatency())
+	data, err = p.GetMemberData(context.Background(), pod)
+	if err != nil || data.APILatency < delay {
+		t.Errorf("expected latency of at least %v, got %v with error %v", delay, data.APILatency, err)
+	}
+	members, errs := p.GetMembersData(context.Background(), []*v1.Pod{pod})
+	if len(errs) != 0 || members["acid-test-0"].APILatency < delay {
+		t.Errorf("expected latency of at least %v in batch, got %v with errors %v", delay, members["acid-test-0"].APILatency, errs)
+	}
+}
+
+func TestWithDialTimeout(t *testing.T) {
+	p := New(nil, nil, WithDialTimeout(50*time.Millisecond))
+
+	client, ok := p.httpClient.(*http.Client)
+	if !ok {
+		t.Fatalf("expected an *http.Client, got %T", p.httpClient)
+	}
+	if client.Timeout != 0 {
+		t.Errorf("expected the overall timeout to be left to the request context, got %v", client.Timeout)
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport.DialContext == nil {
+		t.Fatalf("expected a transport with a custom dialer, got %T", client.Transport)
+	}
+
+	// a resolver which never answers stands in for an unreachable pod, the
+	// dial timeout covers the lookup as well
+	dialer := p.newDialer()
+	dialer.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	start := time.Now()
+	_, err := dialer.DialContext(context.Background(), "tcp", "acid-test-0.invalid:8008")
+	if err == nil {
+		t.Fatal("expected connecting to an unreachable pod to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected connection to be aborted after the dial timeout, took %v", elapsed)
+	}
+}
+
+func TestWithPort(t *testing.T) {
+	pod := newMockPod("192.168.100.1")
+	namedPod := newMockPod("192.168.100.1")
+	namedPod.Spec.Containers = []v1.Container{{
+		Name: "postgres",
+		Ports: []v1.ContainerPort{
+			{ContainerPort: 5432},
+			{Name: "patroni", ContainerPort: 8010},
+		},
+	}}
+
+	var testTable = []struct {
+		subtest       string
+		options       []Option
+		pod           *v1.Pod
+		expected      string
+		expectedError bool
+	}{
+		{
+			subtest:  "default port",
+			pod:      pod,
+			expected: "http://192.168.100.1:8008",
+		},
+		{
+			subtest:  "configured port",
+			options:  []Option{WithPort(8009)},
+			pod:      pod,
+			expected: "http://192.168.100.1:8009",
+		},
+		{
+			subtest:  "named container port",
+			pod:      namedPod,
+			expected: "http://192.168.100.1:8010",
+		},
+		{
+			subtest:  "configured port takes precedence",
+			options:  []Option{WithPort(8009)},
+			pod:      namedPod,
+			expected: "http://192.168.100.1:8009",
+		},
+		{
+			subtest:       "port out of range",
+			options:       []Option{WithPort(65536)},
+			pod:           pod,
+			expectedError: true,
+		},
+		{
+			subtest:       "negative port",
+			options:       []Option{WithPort(-1)},
+			pod:           pod,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		var urls []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			urls = append(urls, request.URL.String())
+			return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+		}}
+		p := New(testLogger, client, tt.options...)
+
+		_, memberErr := p.GetMemberData(context.Background(), tt.pod)
+		_, configErr := p.GetConfig(context.Background(), tt.pod)
+		switchoverErr := p.Switchover(context.Background(), tt.pod, "acid-test-1")
+		if tt.expectedError {
+			if memberErr == nil || configErr == nil || switchoverErr == nil {
+				t.Errorf("%s: expected every call to fail, got %v, %v, %v", tt.subtest, memberErr, configErr, switchoverErr)
+			}
+			if len(urls) != 0 {
+				t.Errorf("%s: expected no requests, got %v", tt.subtest, urls)
+			}
+			continue
+		}
+		expected := []string{tt.expected, tt.expected + configPath, tt.expected + failoverPath}
+		if !reflect.DeepEqual(urls, expected) {
+			t.Errorf("%s: expected %v, got %v", tt.subtest, expected, urls)
+		}
+	}
+}
+
+func TestWithPodDNSNames(t *testing.T) {
+	pod := newMockNamedPod("acid-test-0", "")
+	pod.Namespace = "default"
+	pod.Spec.Subdomain = "acid-test"
+	hostnamePod := pod.DeepCopy()
+	hostnamePod.Spec.Hostname = "member-0"
+	ipPod := newMockNamedPod("acid-test-1", "192.168.100.2")
+	ipPod.Namespace = "default"
+
+	var testTable = []struct {
+		subtest       string
+		options       []Option
+		pod           *v1.Pod
+		expected      string
+		expectedError bool
+	}{
+		{
+			subtest:  "pod name",
+			options:  []Option{WithPodDNSNames()},
+			pod:      pod,
+			expected: "http://acid-test-0.acid-test.default.svc:8008",
+		},
+		{
+			subtest:  "hostname",
+			options:  []Option{WithPodDNSNames(), WithPort(8009)},
+			pod:      hostnamePod,
+			expected: "http://member-0.acid-test.default.svc:8009",
+		},
+		{
+			subtest:  "no subdomain",
+			options:  []Option{WithPodDNSNames()},
+			pod:      ipPod,
+			expected: "http://192.168.100.2:8008",
+		},
+		{
+			subtest:       "disabled",
+			pod:           pod,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		url, err := New(nil, nil, tt.options...).apiURL(tt.pod)
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if url != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.subtest, tt.expected, url)
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	var testTable = []struct {
+		subtest          string
+		options          []Option
+		ctxTimeout       time.Duration
+		expectedDeadline time.Duration
+	}{
+		{
+			subtest:          "default timeout",
+			expectedDeadline: 30 * time.Second,
+		},
+		{
+			subtest:          "configured timeout",
+			options:          []Option{WithTimeout(2 * time.Second)},
+			expectedDeadline: 2 * time.Second,
+		},
+		{
+			subtest:          "context deadline takes precedence",
+			options:          []Option{WithTimeout(2 * time.Second)},
+			ctxTimeout:       2 * time.Minute,
+			expectedDeadline: 2 * time.Minute,
+		},
+		{
+			subtest: "no timeout",
+			options: []Option{WithTimeout(0)},
+		},
+	}
+	for _, tt := range testTable {
+		var deadline time.Duration
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if d, ok := request.Context().Deadline(); ok {
+				deadline = time.Until(d)
+			}
+			return newMockResponse(http.StatusOK, "{}"), nil
+		}}
+		ctx := context.Background()
+		if tt.ctxTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tt.ctxTimeout)
+			defer cancel()
+		}
+		p := New(testLogger, nil, append(tt.options, WithHTTPClient(client))...)
+
+		if _, err := p.GetConfig(ctx, newMockPod("192.168.100.1")); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if deadline > tt.expectedDeadline || deadline < tt.expectedDeadline-time.Second {
+			t.Errorf("%s: expected a deadline in %v, got %v", tt.subtest, tt.expectedDeadline, deadline)
+		}
+	}
+}
+
+func TestWithScheme(t *testing.T) {
+	url, err := New(nil, nil, WithScheme("https")).apiURL(newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "https://192.168.100.1:8008"; url != expected {
+		t.Errorf("expected %q, got %q", expected, url)
+	}
+}
+
+func TestWithBasicAuth(t *testing.T) {
+	var testTable = []struct {
+		subtest          string
+		options          []Option
+		expectedGetAuth  bool
+		expectedPostAuth bool
+	}{
+		{
+			subtest: "no credentials",
+		},
+		{
+			subtest:          "mutating requests",
+			options:          []Option{WithBasicAuth("patroni", "secret")},
+			expectedPostAuth: true,
+		},
+		{
+			subtest:          "all requests",
+			options:          []Option{WithBasicAuth("patroni", "secret"), WithAuthenticatedReads()},
+			expectedGetAuth:  true,
+			expectedPostAuth: true,
+		},
+	}
+	for _, tt := range testTable {
+		authenticated := make(map[string]bool)
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			username, password, ok := request.BasicAuth()
+			authenticated[request.Method] = ok && username == "patroni" && password == "secret"
+			return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+		}}
+		logger, hook := test.NewNullLogger()
+		logger.SetLevel(logrus.TraceLevel)
+		p := New(logger.WithField("test", tt.subtest), client, append(tt.options, WithTraceBodies())...)
+		pod := newMockNamedPod("acid-test-0", "192.168.100.1")
+
+		if _, err := p.GetMemberData(context.Background(), pod); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if err := p.Switchover(context.Background(), pod, "acid-test-1"); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if authenticated[http.MethodGet] != tt.expectedGetAuth || authenticated[http.MethodPost] != tt.expectedPostAuth {
+			t.Errorf("%s: expected authenticated GET %t and POST %t, got %v", tt.subtest, tt.expectedGetAuth, tt.expectedPostAuth, authenticated)
+		}
+		for _, entry := range hook.AllEntries() {
+			if message, _ := entry.String(); strings.Contains(message, "secret") {
+				t.Errorf("%s: credentials logged in %q", tt.subtest, message)
+			}
+		}
+	}
+}
@@ -2,62 +2,206 @@ package patroni
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	httpclient "github.com/zalando/postgres-operator/pkg/util/httpclient"
+	"github.com/zalando/postgres-operator/pkg/util/ringlog"
 
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 )
 
 const (
-	failoverPath = "/failover"
-	configPath   = "/config"
-	statusPath   = "/patroni"
-	restartPath  = "/restart"
-	apiPort      = 8008
-	timeout      = 30 * time.Second
+	failoverPath   = "/failover"
+	switchoverPath = "/switchover"
+	configPath     = "/config"
+	statusPath     = "/patroni"
+	clusterPath    = "/cluster"
+	restartPath    = "/restart"
+	historyPath    = "/history"
+	reinitPath     = "/reinitialize"
+	reloadPath     = "/reload"
+	livenessPath   = "/liveness"
+	readinessPath  = "/readiness"
+	apiPort        = 8008
+	apiPortName    = "patroni"
+	defaultTimeout = 30 * time.Second
+
+	idempotencyKeyHeader = "Idempotency-Key"
 )
 
+// ErrNotLeader is returned when an operation requires the leader, but the
+// member it was sent to is not the leader
+var ErrNotLeader = errors.New("member is not the leader")
+
+// ErrNotSupported is returned when the Patroni API does not expose the
+// requested information
+var ErrNotSupported = errors.New("not supported by the Patroni API")
+
+// APIError is returned when Patroni answers with an error status. Use
+// errors.As to inspect it, or errors.Is with an APIError carrying only the
+// fields to match, e.g. &APIError{StatusCode: http.StatusServiceUnavailable}.
+type APIError struct {
+	StatusCode int
+	Body       string
+	Path       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("patroni returned '%d' for %s: %s", e.StatusCode, e.Path, strings.TrimSpace(e.Body))
+}
+
+// Is matches an APIError target on its non-empty status code and path
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	if !ok {
+		return false
+	}
+	return (t.StatusCode == 0 || t.StatusCode == e.StatusCode) && (t.Path == "" || t.Path == e.Path)
+}
+
+// newAPIError describes an error response to a request of the given URL
+func newAPIError(status int, rawURL string, body []byte) *APIError {
+	path := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil {
+		path = parsed.Path
+	}
+	return &APIError{StatusCode: status, Body: string(body), Path: path}
+}
+
 // Interface describe patroni methods
 type Interface interface {
-	Switchover(master *v1.Pod, candidate string) error
-	SetPostgresParameters(server *v1.Pod, options map[string]string) error
-	GetMemberData(server *v1.Pod) (MemberData, error)
-	Restart(server *v1.Pod) error
-	GetConfig(server *v1.Pod) (map[string]interface{}, error)
-	SetConfig(server *v1.Pod, config map[string]interface{}) error
+	Switchover(ctx context.Context, master *v1.Pod, candidate string) error
+	SetPostgresParameters(ctx context.Context, server *v1.Pod, options map[string]string) error
+	GetMemberData(ctx context.Context, server *v1.Pod) (MemberData, error)
+	Restart(ctx context.Context, server *v1.Pod) (bool, error)
+	GetConfig(ctx context.Context, server *v1.Pod) (map[string]interface{}, error)
+	SetConfig(ctx context.Context, server *v1.Pod, config map[string]interface{}) error
 }
 
 // Patroni API client
 type Patroni struct {
-	httpClient httpclient.HTTPClient
-	logger     *logrus.Entry
+	httpClient   httpclient.HTTPClient
+	logger       *logrus.Entry
+	traceBodies  bool
+	redactedKeys []string
+	clock        Clock
+	scheme       string
+	port         int
+
+	requireLeader      bool
+	tlsConfig          *tls.Config
+	pinnedFingerprint  string
+	username           string
+	password           string
+	authenticateReads  bool
+	operations         *ringlog.RingLog
+	metrics            *apiMetrics
+	applyTimeout       time.Duration
+	strictDecode       bool
+	recordLatency      bool
+	mutableKeys        []string
+	maxLoggedBodySize  int
+	dialTimeout        time.Duration
+	skipPauseCheck     bool
+	retryPolicy        RetryPolicy
+	healthWeights      HealthWeights
+	clockSkewThreshold time.Duration
+	idempotencyKeys    bool
+	lightweight        bool
+	podDNSNames        bool
+	timeout            time.Duration
+	pollInterval       time.Duration
+
+	mu             sync.Mutex
+	lastSwitchover map[string]time.Time
+	managedSlots   map[string]bool
+	versions       map[string]string
 }
 
-// New create patroni
-func New(logger *logrus.Entry, client httpclient.HTTPClient) *Patroni {
-	if client == nil {
+// New create patroni. Without options and with a nil client it uses a plain
+// HTTP client and limits every call to 30 seconds.
+func New(logger *logrus.Entry, client httpclient.HTTPClient, options ...Option) *Patroni {
+	p := &Patroni{
+		logger:         logger,
+		httpClient:     client,
+		redactedKeys:   defaultRedactedKeys,
+		lastSwitchover: make(map[string]time.Time),
+		managedSlots:   make(map[string]bool),
+		versions:       make(map[string]string),
+		clock:          realClock{},
+		scheme:         "http",
+		timeout:        defaultTimeout,
+		pollInterval:   defaultPollInterval,
+
+		clockSkewThreshold: defaultClockSkewThreshold,
+		applyTimeout:       defaultApplyTimeout,
+		healthWeights:      DefaultHealthWeights,
+	}
+	for _, option := range options {
+		option(p)
+	}
 
-		client = &http.Client{
-			Timeout: timeout,
-		}
+	if p.httpClient == nil {
+		p.httpClient = p.newHTTPClient()
+	}
+
+	return p
+}
+
+// newHTTPClient creates the default client, honoring the transport options
+func (p *Patroni) newHTTPClient() *http.Client {
+	client := &http.Client{}
+	if p.tlsConfig == nil && p.dialTimeout == 0 {
+		return client
+	}
 
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.tlsConfig != nil {
+		transport.TLSClientConfig = p.tlsConfig
+		if p.pinnedFingerprint != "" {
+			transport.TLSClientConfig.VerifyPeerCertificate = verifyPinnedCertificate(p.pinnedFingerprint)
+		}
+	}
+	if p.dialTimeout > 0 {
+		transport.DialContext = p.newDialer().DialContext
 	}
+	client.Transport = transport
+	return client
+}
 
-	return &Patroni{
-		logger:     logger,
-		httpClient: client,
+// newDialer returns the dialer of the HTTP client created by New, which
+// gives up on a connection after the dial timeout
+func (p *Patroni) newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   p.dialTimeout,
+		KeepAlive: 30 * time.Second,
 	}
 }
 
-func apiURL(masterPod *v1.Pod) (string, error) {
+func (p *Patroni) apiURL(masterPod *v1.Pod) (string, error) {
+	port, err := p.apiPort(masterPod)
+	if err != nil {
+		return "", err
+	}
+	if host := podDNSName(masterPod); p.podDNSNames && host != "" {
+		return fmt.Sprintf("%s://%s", p.scheme, net.JoinHostPort(host, strconv.Itoa(port))), nil
+	}
+
 	ip := net.ParseIP(masterPod.Status.PodIP)
 	if ip == nil {
 		return "", fmt.Errorf("%s is not a valid IP", masterPod.Status.PodIP)
@@ -68,24 +212,121 @@ func apiURL(masterPod *v1.Pod) (string, error) {
 			// Shouldn't ever get here, but library states it's possible.
 			return "", fmt.Errorf("%s is not a valid IPv4/IPv6 address", masterPod.Status.PodIP)
 		}
+		// link-local addresses are only routable together with a zone
+		if ip.IsLinkLocalUnicast() {
+			return "", fmt.Errorf("%s is an IPv6 link-local address, which is not routable without a zone", masterPod.Status.PodIP)
+		}
+	}
+	return fmt.Sprintf("%s://%s", p.scheme, net.JoinHostPort(ip.String(), strconv.Itoa(port))), nil
+}
+
+// podDNSName returns the name of the pod in the DNS of its headless service,
+// empty if the pod has no subdomain
+func podDNSName(pod *v1.Pod) string {
+	if pod.Spec.Subdomain == "" || pod.Namespace == "" {
+		return ""
+	}
+	hostname := pod.Spec.Hostname
+	if hostname == "" {
+		hostname = pod.Name
+	}
+	return fmt.Sprintf("%s.%s.%s.svc", hostname, pod.Spec.Subdomain, pod.Namespace)
+}
+
+// apiPort returns the port set WithPort, otherwise the container port named
+// "patroni" of the pod, falling back to the Patroni default
+func (p *Patroni) apiPort(pod *v1.Pod) (int, error) {
+	if p.port != 0 {
+		if p.port < 1 || p.port > 65535 {
+			return 0, fmt.Errorf("%d is not a valid port", p.port)
+		}
+		return p.port, nil
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == apiPortName {
+				return int(port.ContainerPort), nil
+			}
+		}
+	}
+	return apiPort, nil
+}
+
+// withDefaultTimeout limits a request to the timeout of the client, unless
+// the context already has a deadline
+func (p *Patroni) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || p.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+// newRequest creates a request, with basic auth credentials if the client
+// has them and the method requires them
+func (p *Patroni) newRequest(ctx context.Context, method string, url string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if p.username != "" && (method != http.MethodGet || p.authenticateReads) {
+		request.SetBasicAuth(p.username, p.password)
+	}
+	return request, nil
+}
+
+func (p *Patroni) httpPostOrPatch(ctx context.Context, method string, url string, body *bytes.Buffer) error {
+	ctx, cancel := p.withDefaultTimeout(ctx)
+	defer cancel()
+
+	payload := body.Bytes()
+	var key string
+	if p.idempotencyKeys {
+		var err error
+		if key, err = newIdempotencyKey(); err != nil {
+			return err
+		}
 	}
-	return fmt.Sprintf("http://%s", net.JoinHostPort(ip.String(), strconv.Itoa(apiPort))), nil
+	return p.withRetry(ctx, method, url, func() (int, error) {
+		return p.postOrPatchOnce(ctx, method, url, payload, key)
+	})
 }
 
-func (p *Patroni) httpPostOrPatch(method string, url string, body *bytes.Buffer) (err error) {
-	request, err := http.NewRequest(method, url, body)
+// newIdempotencyKey returns a random UUID identifying a request across its
+// retries
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate idempotency key: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func (p *Patroni) postOrPatchOnce(ctx context.Context, method string, url string, payload []byte, idempotencyKey string) (status int, err error) {
+	start := time.Now()
+	defer func() {
+		p.recordOperation(start, method, url, status, err)
+	}()
+
+	request, err := p.newRequest(ctx, method, url, bytes.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("could not create request: %v", err)
+		return 0, fmt.Errorf("could not create request: %v", err)
+	}
+	if idempotencyKey != "" {
+		request.Header.Set(idempotencyKeyHeader, idempotencyKey)
 	}
 
 	if p.logger != nil {
 		p.logger.Debugf("making %s http request: %s", method, request.URL.String())
 	}
+	p.traceBody("request", method, url, payload)
 
 	resp, err := p.httpClient.Do(request)
 	if err != nil {
-		return fmt.Errorf("could not make request: %v", err)
+		return 0, fmt.Errorf("could not make request: %w", err)
 	}
+	status = resp.StatusCode
 	defer func() {
 		if err2 := resp.Body.Close(); err2 != nil {
 			if err != nil {
@@ -97,85 +338,181 @@ func (p *Patroni) httpPostOrPatch(method string, url string, body *bytes.Buffer)
 		}
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("could not read response: %v", err)
-		}
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return status, fmt.Errorf("could not read response: %v", err)
+	}
+	p.traceBody("response", method, url, bodyBytes)
 
-		return fmt.Errorf("patroni returned '%s'", string(bodyBytes))
+	// scheduled operations and reloads are answered with 202
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return status, newAPIError(resp.StatusCode, url, bodyBytes)
 	}
-	return nil
+	return status, nil
+}
+
+func (p *Patroni) httpGet(ctx context.Context, url string) (body string, err error) {
+	ctx, cancel := p.withDefaultTimeout(ctx)
+	defer cancel()
+
+	err = p.withRetry(ctx, http.MethodGet, url, func() (status int, attemptErr error) {
+		body, status, attemptErr = p.getOnce(ctx, url)
+		return status, attemptErr
+	})
+	return body, err
 }
 
-func (p *Patroni) httpGet(url string) (string, error) {
-	request, err := http.NewRequest("GET", url, nil)
+func (p *Patroni) getOnce(ctx context.Context, url string) (body string, status int, err error) {
+	start := time.Now()
+	defer func() {
+		p.recordOperation(start, http.MethodGet, url, status, err)
+	}()
+
+	request, err := p.newRequest(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return "", fmt.Errorf("could not create request: %v", err)
+		return "", 0, fmt.Errorf("could not create request: %v", err)
 	}
 
-	p.logger.Debugf("making GET http request: %s", request.URL.String())
+	if p.logger != nil {
+		p.logger.Debugf("making GET http request: %s", request.URL.String())
+	}
 
 	resp, err := p.httpClient.Do(request)
 	if err != nil {
-		return "", fmt.Errorf("could not make request: %v", err)
+		return "", 0, fmt.Errorf("could not make request: %w", err)
 	}
+	status = resp.StatusCode
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("could not read response: %v", err)
+		return "", status, fmt.Errorf("could not read response: %v", err)
 	}
+	p.traceBody("response", http.MethodGet, url, bodyBytes)
 	if err := resp.Body.Close(); err != nil {
-		return "", fmt.Errorf("could not close request: %v", err)
+		return "", status, fmt.Errorf("could not close request: %v", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return string(bodyBytes), fmt.Errorf("patroni returned '%d'", resp.StatusCode)
+		return string(bodyBytes), status, newAPIError(resp.StatusCode, url, bodyBytes)
 	}
-	return string(bodyBytes), nil
+	return string(bodyBytes), status, nil
 }
 
-// Switchover by calling Patroni REST API
-func (p *Patroni) Switchover(master *v1.Pod, candidate string) error {
+// Switchover performs a planned switchover from master to candidate by
+// calling Patroni REST API. Patroni only accepts it while the master is the
+// running leader, use Failover when it is down.
+func (p *Patroni) Switchover(ctx context.Context, master *v1.Pod, candidate string) error {
 	buf := &bytes.Buffer{}
 	err := json.NewEncoder(buf).Encode(map[string]string{"leader": master.Name, "member": candidate})
 	if err != nil {
 		return fmt.Errorf("could not encode json: %v", err)
 	}
-	apiURLString, err := apiURL(master)
+	return p.call(ctx, master, opFailover, buf)
+}
+
+// Failover promotes the candidate without naming the current leader, which
+// Patroni accepts also when there is no healthy leader. It is a forced
+// operation: unlike Switchover it does not wait for the leader to hand over
+// and may lose transactions not yet replicated to the candidate. The request
+// can be sent to any member of the cluster.
+func (p *Patroni) Failover(ctx context.Context, cluster *v1.Pod, candidate string) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]string{"candidate": candidate})
 	if err != nil {
-		return err
+		return fmt.Errorf("could not encode json: %v", err)
 	}
-	return p.httpPostOrPatch(http.MethodPost, apiURLString+failoverPath, buf)
+	return p.call(ctx, cluster, opFailover, buf)
 }
 
-//TODO: add an option call /patroni to check if it is necessary to restart the server
+// SwitchoverGroup performs a planned switchover like Switchover within the
+// given Citus group, where every group has its own leader. The request can
+// be sent to the coordinator or to a member of the group.
+func (p *Patroni) SwitchoverGroup(ctx context.Context, master *v1.Pod, candidate string, group int) error {
+	return p.groupFailover(ctx, master, group, map[string]interface{}{"leader": master.Name, "member": candidate})
+}
 
-//SetPostgresParameters sets Postgres options via Patroni patch API call.
-func (p *Patroni) SetPostgresParameters(server *v1.Pod, parameters map[string]string) error {
+// FailoverGroup promotes the candidate like Failover within the given Citus
+// group.
+func (p *Patroni) FailoverGroup(ctx context.Context, cluster *v1.Pod, candidate string, group int) error {
+	return p.groupFailover(ctx, cluster, group, map[string]interface{}{"candidate": candidate})
+}
+
+// groupFailover posts a failover request targeting a Citus group
+func (p *Patroni) groupFailover(ctx context.Context, server *v1.Pod, group int, body map[string]interface{}) error {
+	body["group"] = group
 	buf := &bytes.Buffer{}
-	err := json.NewEncoder(buf).Encode(map[string]map[string]interface{}{"postgresql": {"parameters": parameters}})
-	if err != nil {
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
 		return fmt.Errorf("could not encode json: %v", err)
 	}
-	apiURLString, err := apiURL(server)
+	return p.call(ctx, server, opFailover, buf)
+}
+
+// ScheduledFailover asks Patroni to switch over from master to candidate at
+// the given time, which has to be in the future. The zero time switches over
+// immediately like Switchover. A time rejected by Patroni is reported as
+// ErrInvalidSchedule.
+func (p *Patroni) ScheduledFailover(ctx context.Context, master *v1.Pod, candidate string, at time.Time) error {
+	if at.IsZero() {
+		return p.Switchover(ctx, master, candidate)
+	}
+	if !at.After(p.clock.Now()) {
+		return fmt.Errorf("scheduled time %s is not in the future: %w", at.Format(time.RFC3339), ErrInvalidSchedule)
+	}
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]string{
+		"leader":       master.Name,
+		"member":       candidate,
+		"scheduled_at": at.Format(time.RFC3339),
+	})
 	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	err = p.call(ctx, master, opFailover, buf)
+	if errors.Is(err, &APIError{StatusCode: http.StatusUnprocessableEntity}) {
+		return fmt.Errorf("could not schedule switchover at %s: %v: %w", at.Format(time.RFC3339), err, ErrInvalidSchedule)
+	}
+	return err
+}
+
+//TODO: add an option call /patroni to check if it is necessary to restart the server
+
+//SetPostgresParameters sets Postgres options via Patroni patch API call.
+// Parameters managed by Patroni itself are set nonetheless, but have no
+// effect, which is logged as a warning.
+func (p *Patroni) SetPostgresParameters(ctx context.Context, server *v1.Pod, parameters map[string]string) error {
+	for name := range parameters {
+		if isManagedParameter(name) && p.logger != nil {
+			p.logger.Warningf("parameter %s is managed by Patroni, setting it has no effect", name)
+		}
+	}
+	patch := map[string]interface{}{"postgresql": map[string]interface{}{"parameters": parameters}}
+	if err := p.checkMutableKeys(patch); err != nil {
+		return err
+	}
+	if err := p.checkLeader(ctx, server); err != nil {
 		return err
 	}
-	return p.httpPostOrPatch(http.MethodPatch, apiURLString+configPath, buf)
+	return p.patchConfig(ctx, server, patch)
 }
 
 //SetConfig sets Patroni options via Patroni patch API call.
-func (p *Patroni) SetConfig(server *v1.Pod, config map[string]interface{}) error {
+func (p *Patroni) SetConfig(ctx context.Context, server *v1.Pod, config map[string]interface{}) error {
+	if err := p.checkMutableKeys(config); err != nil {
+		return err
+	}
+	if err := p.checkLeader(ctx, server); err != nil {
+		return err
+	}
+	return p.patchConfig(ctx, server, config)
+}
+
+// patchConfig sends a config patch without checking its keys or the target
+func (p *Patroni) patchConfig(ctx context.Context, server *v1.Pod, config map[string]interface{}) error {
 	buf := &bytes.Buffer{}
 	err := json.NewEncoder(buf).Encode(config)
 	if err != nil {
 		return fmt.Errorf("could not encode json: %v", err)
 	}
-	apiURLString, err := apiURL(server)
-	if err != nil {
-		return err
-	}
-	return p.httpPostOrPatch(http.MethodPatch, apiURLString+configPath, buf)
+	return p.call(ctx, server, opPatchConfig, buf)
 }
 
 // MemberDataPatroni child element
@@ -184,6 +521,27 @@ type MemberDataPatroni struct {
 	Scope   string `json:"scope"`
 }
 
+// MemberDataXlog child element, the leader reports only Location while
+// replicas report the received and replayed positions and, depending on the
+// Patroni version, their lag in bytes
+type MemberDataXlog struct {
+	Location         int64 `json:"location"`
+	ReceivedLocation int64 `json:"received_location"`
+	ReplayedLocation int64 `json:"replayed_location"`
+	Paused           bool  `json:"paused"`
+}
+
+// MemberDataReplication child element, the leader reports one per connected
+// standby as seen in pg_stat_replication
+type MemberDataReplication struct {
+	Usename         string `json:"usename"`
+	ApplicationName string `json:"application_name"`
+	ClientAddr      string `json:"client_addr"`
+	State           string `json:"state"`
+	SyncState       string `json:"sync_state"`
+	SyncPriority    int    `json:"sync_priority"`
+}
+
 // MemberData Patroni member data from Patroni API
 type MemberData struct {
 	State           string            `json:"state"`
@@ -192,73 +550,177 @@ type MemberData struct {
 	PendingRestart  bool              `json:"pending_restart"`
 	ClusterUnlocked bool              `json:"cluster_unlocked"`
 	Patroni         MemberDataPatroni `json:"patroni"`
+	Xlog            MemberDataXlog    `json:"xlog"`
+	SystemID        string            `json:"database_system_identifier"`
+	Timeline        int               `json:"timeline"`
+	// ReplicationState is reported by replicas only, e.g. "streaming" or
+	// "in archive recovery", by Patroni 3.0 and later
+	ReplicationState string `json:"replication_state"`
+	// Lag is the replication lag in bytes, the WAL location of the leader
+	// minus the replayed location. Patroni does not report it per member,
+	// so it is only set by GetMembersData on replicas queried together with
+	// their leader.
+	Lag         *int64                  `json:"-"`
+	DCSLastSeen int64                   `json:"dcs_last_seen"`
+	SyncStandby bool                    `json:"sync_standby"`
+	Replication []MemberDataReplication `json:"replication"`
+	Tags        map[string]interface{}  `json:"tags"`
+	// PostmasterStartTime is formatted like "2023-09-25 13:15:12.617045+00:00"
+	PostmasterStartTime string `json:"postmaster_start_time"`
+	// PendingRestartReason maps each parameter requiring a restart to its
+	// old and new value, reported by Patroni 3.0.4 and later
+	PendingRestartReason map[string]interface{} `json:"pending_restart_reason"`
+	// APILatency is the round trip time of the status call, only recorded
+	// by clients created WithAPILatency
+	APILatency time.Duration `json:"-"`
+}
+
+// IsLeader tells whether the member holds the leader role
+func (m MemberData) IsLeader() bool {
+	return m.Role == "master" || m.Role == "primary"
 }
 
-func (p *Patroni) GetConfigOrStatus(server *v1.Pod, path string) (map[string]interface{}, error) {
+// GetConfigOrStatus reads the given endpoint of a member. Errors name the
+// endpoint and the pod. A response with an error status is still accepted
+// when its body parses, since e.g. /patroni answers 503 with the complete
+// status while Postgres is not running.
+func (p *Patroni) GetConfigOrStatus(ctx context.Context, server *v1.Pod, path string) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
-	apiURLString, err := apiURL(server)
+	apiURLString, err := p.apiURL(server)
 	if err != nil {
-		return result, err
+		return result, fmt.Errorf("could not get %s of %s: %v", path, server.Name, err)
 	}
-	body, err := p.httpGet(apiURLString + path)
+	body, httpErr := p.httpGet(ctx, apiURLString+path)
 	err = json.Unmarshal([]byte(body), &result)
 	if err != nil {
-		return result, err
+		if httpErr != nil {
+			return result, fmt.Errorf("could not get %s of %s: %w", path, server.Name, httpErr)
+		}
+		return result, fmt.Errorf("could not parse %s of %s: %v", path, server.Name, err)
 	}
 
-	return result, err
+	return result, nil
 }
 
-func (p *Patroni) GetStatus(server *v1.Pod) (map[string]interface{}, error) {
-	return p.GetConfigOrStatus(server, statusPath)
+func (p *Patroni) GetStatus(ctx context.Context, server *v1.Pod) (map[string]interface{}, error) {
+	return p.GetConfigOrStatus(ctx, server, statusPath)
 }
 
-func (p *Patroni) GetConfig(server *v1.Pod) (map[string]interface{}, error) {
-	return p.GetConfigOrStatus(server, configPath)
+func (p *Patroni) GetConfig(ctx context.Context, server *v1.Pod) (map[string]interface{}, error) {
+	return p.GetConfigOrStatus(ctx, server, configPath)
 }
 
 //Restart method restarts instance via Patroni POST API call.
-func (p *Patroni) Restart(server *v1.Pod) error {
+// It only restarts if Patroni reports a pending restart and tells whether the
+// restart was actually issued, see RestartIfPending.
+func (p *Patroni) Restart(ctx context.Context, server *v1.Pod) (bool, error) {
+	return p.RestartIfPending(ctx, server)
+}
+
+// IsRestartPending tells whether Patroni reports that the member has to be
+// restarted to apply parameter changes, without restarting it
+func (p *Patroni) IsRestartPending(ctx context.Context, server *v1.Pod) (bool, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return false, err
+	}
+	return data.PendingRestart, nil
+}
+
+// RestartIfPending restarts the instance only if Patroni reports a pending
+// restart and tells whether the restart was actually issued
+func (p *Patroni) RestartIfPending(ctx context.Context, server *v1.Pod) (bool, error) {
 	buf := &bytes.Buffer{}
 	err := json.NewEncoder(buf).Encode(map[string]interface{}{"restart_pending": true})
 	if err != nil {
-		return fmt.Errorf("could not encode json: %v", err)
+		return false, fmt.Errorf("could not encode json: %v", err)
 	}
-	apiURLString, err := apiURL(server)
+	status, err := p.GetStatus(ctx, server)
 	if err != nil {
-		return err
+		return false, err
 	}
-	status, err := p.GetStatus(server)
-	pending_restart, ok := status["pending_restart"]
-	if !ok || !pending_restart.(bool) {
-		return nil
+	pendingRestart, ok := status["pending_restart"].(bool)
+	if !ok || !pendingRestart {
+		return false, nil
 	}
-	return p.httpPostOrPatch(http.MethodPost, apiURLString+restartPath, buf)
+	if err := p.call(ctx, server, opRestart, buf); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reload makes Patroni reload its configuration and Postgres right away
+// instead of in the next HA loop, which applies changes like loop_wait or
+// parameters that do not need a restart
+func (p *Patroni) Reload(ctx context.Context, server *v1.Pod) error {
+	apiURLString, err := p.apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPost, apiURLString+reloadPath, &bytes.Buffer{})
 }
 
 // GetMemberData read member data from patroni API
-func (p *Patroni) GetMemberData(server *v1.Pod) (MemberData, error) {
+func (p *Patroni) GetMemberData(ctx context.Context, server *v1.Pod) (MemberData, error) {
 
-	apiURLString, err := apiURL(server)
+	apiURLString, err := p.apiURL(server)
 	if err != nil {
 		return MemberData{}, err
 	}
-	response, err := p.httpClient.Get(apiURLString)
-	if err != nil {
-		return MemberData{}, fmt.Errorf("could not perform Get request: %v", err)
-	}
-	defer response.Body.Close()
-
-	body, err := ioutil.ReadAll(response.Body)
+	ctx, cancel := p.withDefaultTimeout(ctx)
+	defer cancel()
+
+	var body string
+	var latency time.Duration
+	// the status is answered with 503 when Postgres is not running, which is
+	// valid member data and not retried
+	err = p.withRetry(ctx, http.MethodGet, apiURLString, func() (int, error) {
+		start := time.Now()
+		var status int
+		var attemptErr error
+		body, status, attemptErr = p.getOnce(ctx, apiURLString)
+		latency = time.Since(start)
+		if errors.Is(attemptErr, &APIError{StatusCode: http.StatusServiceUnavailable}) {
+			return status, nil
+		}
+		return status, attemptErr
+	})
 	if err != nil {
-		return MemberData{}, fmt.Errorf("could not read response: %v", err)
+		return MemberData{}, err
 	}
 
 	data := MemberData{}
-	err = json.Unmarshal(body, &data)
+	err = p.decode([]byte(body), &data)
 	if err != nil {
 		return MemberData{}, err
 	}
+	if p.recordLatency {
+		data.APILatency = latency
+	}
+	p.rememberVersion(server, data.Patroni.Version)
 
 	return data, nil
 }
+
+// decode parses a JSON response, rejecting fields which are not modelled in
+// strict mode
+func (p *Patroni) decode(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if p.strictDecode {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// GetPrimaryLSN returns the current WAL location of the primary
+func (p *Patroni) GetPrimaryLSN(ctx context.Context, server *v1.Pod) (int64, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return 0, err
+	}
+	if !data.IsLeader() {
+		return 0, fmt.Errorf("could not get primary LSN from %s with role %q: %w", server.Name, data.Role, ErrNotLeader)
+	}
+
+	return data.Xlog.Location, nil
+}
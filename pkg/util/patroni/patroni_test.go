@@ -2,18 +2,24 @@ package patroni
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
 	"github.com/zalando/postgres-operator/mocks"
 
 	v1 "k8s.io/api/core/v1"
 )
 
+var testLogger = logrus.New().WithField("test", "patroni")
+
 func newMockPod(ip string) *v1.Pod {
 	return &v1.Pod{
 		Status: v1.PodStatus{
@@ -43,6 +49,21 @@ func TestApiURL(t *testing.T) {
 			fmt.Sprintf("http://[::1]:%d", apiPort),
 			nil,
 		},
+		{
+			"2001:db8::10",
+			fmt.Sprintf("http://[2001:db8::10]:%d", apiPort),
+			nil,
+		},
+		{
+			"fe80::1",
+			"",
+			errors.New("fe80::1 is an IPv6 link-local address, which is not routable without a zone"),
+		},
+		{
+			"169.254.1.1",
+			fmt.Sprintf("http://169.254.1.1:%d", apiPort),
+			nil,
+		},
 		{
 			"",
 			"",
@@ -65,7 +86,7 @@ func TestApiURL(t *testing.T) {
 		},
 	}
 	for _, test := range testTable {
-		resp, err := apiURL(newMockPod(test.podIP))
+		resp, err := New(nil, nil).apiURL(newMockPod(test.podIP))
 		if resp != test.expectedResponse {
 			t.Errorf("expected response %v does not match the actual %v", test.expectedResponse, resp)
 		}
@@ -88,12 +109,13 @@ func TestPatroniAPI(t *testing.T) {
 	r := ioutil.NopCloser(bytes.NewReader([]byte(json)))
 
 	response := http.Response{
-		Status: "200",
-		Body:   r,
+		Status:     "200",
+		StatusCode: http.StatusOK,
+		Body:       r,
 	}
 
 	mockClient := mocks.NewMockHTTPClient(ctrl)
-	mockClient.EXPECT().Get(gomock.Any()).Return(&response, nil)
+	mockClient.EXPECT().Do(gomock.Any()).Return(&response, nil)
 
 	p := New(nil, mockClient)
 
@@ -102,9 +124,403 @@ func TestPatroniAPI(t *testing.T) {
 			PodIP: "192.168.100.1",
 		},
 	}
-	_, err := p.GetMemberData(&pod)
+	_, err := p.GetMemberData(context.Background(), &pod)
 
 	if err != nil {
 		t.Errorf("Could not read Patroni data: %v", err)
 	}
 }
+
+func newMockResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+	}
+}
+
+func TestGetPrimaryLSN(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	leader := `{"state": "running", "role": "master", "xlog": {"location": 55978296057856}, "timeline": 6}`
+	replica := `{"state": "running", "role": "replica", "xlog": {"received_location": 55978296057856, "replayed_location": 55978296057000, "paused": false}}`
+
+	mockClient := mocks.NewMockHTTPClient(ctrl)
+	mockClient.EXPECT().Do(gomock.Any()).Return(newMockResponse(http.StatusOK, leader), nil)
+	mockClient.EXPECT().Do(gomock.Any()).Return(newMockResponse(http.StatusOK, replica), nil)
+
+	p := New(nil, mockClient)
+
+	lsn, err := p.GetPrimaryLSN(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("could not get primary LSN: %v", err)
+	}
+	if lsn != 55978296057856 {
+		t.Errorf("expected LSN %d, got %d", int64(55978296057856), lsn)
+	}
+
+	_, err = p.GetPrimaryLSN(context.Background(), newMockPod("192.168.100.2"))
+	if !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected ErrNotLeader for a replica, got %v", err)
+	}
+}
+
+func newMockNamedPod(name string, ip string) *v1.Pod {
+	pod := newMockPod(ip)
+	pod.Name = name
+	return pod
+}
+
+// stubHTTPClient answers every request with the handler, for tests which
+// need to react on the content of the request
+type stubHTTPClient struct {
+	handler func(*http.Request) (*http.Response, error)
+}
+
+func (c *stubHTTPClient) Do(request *http.Request) (*http.Response, error) {
+	return c.handler(request)
+}
+
+func (c *stubHTTPClient) Get(url string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.handler(request)
+}
+
+func TestRestartIfPending(t *testing.T) {
+	var testTable = []struct {
+		subtest   string
+		status    string
+		restarted bool
+	}{
+		{
+			subtest:   "restart pending",
+			status:    `{"state": "running", "role": "master", "pending_restart": true}`,
+			restarted: true,
+		},
+		{
+			subtest:   "no restart pending",
+			status:    `{"state": "running", "role": "master"}`,
+			restarted: false,
+		},
+	}
+	for _, tt := range testTable {
+		var posts []string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodPost {
+				posts = append(posts, request.URL.Path)
+				return newMockResponse(http.StatusOK, "restarted successfully"), nil
+			}
+			return newMockResponse(http.StatusOK, tt.status), nil
+		}}
+		p := New(testLogger, client)
+
+		restarted, err := p.RestartIfPending(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if restarted != tt.restarted {
+			t.Errorf("%s: expected restarted to be %t, got %t", tt.subtest, tt.restarted, restarted)
+		}
+		if tt.restarted && (len(posts) != 1 || posts[0] != restartPath) {
+			t.Errorf("%s: expected a single restart request, got %v", tt.subtest, posts)
+		}
+		if !tt.restarted && len(posts) != 0 {
+			t.Errorf("%s: expected no restart request, got %v", tt.subtest, posts)
+		}
+	}
+}
+
+func TestGetConfigOrStatusErrors(t *testing.T) {
+	var testTable = []struct {
+		subtest string
+		call    func(p *Patroni, ctx context.Context, pod *v1.Pod) (map[string]interface{}, error)
+		path    string
+	}{
+		{
+			subtest: "config",
+			call:    (*Patroni).GetConfig,
+			path:    configPath,
+		},
+		{
+			subtest: "status",
+			call:    (*Patroni).GetStatus,
+			path:    statusPath,
+		},
+	}
+	for _, tt := range testTable {
+		for _, response := range []*http.Response{
+			newMockResponse(http.StatusServiceUnavailable, "unavailable"),
+			newMockResponse(http.StatusOK, "{not json"),
+		} {
+			client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+				return response, nil
+			}}
+			p := New(testLogger, client)
+
+			_, err := tt.call(p, context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"))
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.subtest)
+				continue
+			}
+			if !strings.Contains(err.Error(), tt.path) || !strings.Contains(err.Error(), "acid-test-0") {
+				t.Errorf("%s: expected path %s and pod name in error, got %q", tt.subtest, tt.path, err)
+			}
+		}
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	var deadlines []time.Time
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		deadline, ok := request.Context().Deadline()
+		if !ok {
+			t.Errorf("expected %s %s to have a deadline", request.Method, request.URL.Path)
+		}
+		deadlines = append(deadlines, deadline)
+		if err := request.Context().Err(); err != nil {
+			return nil, err
+		}
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+	}}
+	p := New(testLogger, client)
+	pod := newMockNamedPod("acid-test-0", "192.168.100.1")
+
+	calls := func(ctx context.Context) []error {
+		_, memberErr := p.GetMemberData(ctx, pod)
+		_, configErr := p.GetConfig(ctx, pod)
+		return []error{memberErr, configErr, p.SetConfig(ctx, pod, map[string]interface{}{"ttl": 30})}
+	}
+
+	start := time.Now()
+	for _, err := range calls(context.Background()) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	for _, deadline := range deadlines {
+		if deadline.Before(start.Add(defaultTimeout)) || deadline.After(time.Now().Add(defaultTimeout)) {
+			t.Errorf("expected the default timeout as deadline, got %v", deadline.Sub(start))
+		}
+	}
+
+	deadlines = nil
+	expected := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.Background(), expected)
+	defer cancel()
+	calls(ctx)
+	for _, deadline := range deadlines {
+		if !deadline.Equal(expected) {
+			t.Errorf("expected the deadline of the context %v, got %v", expected, deadline)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range calls(cancelled) {
+		if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+			t.Errorf("expected calls with cancelled context to fail, got %v", err)
+		}
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		if request.Method == http.MethodPatch {
+			return newMockResponse(http.StatusConflict, "cluster is locked"), nil
+		}
+		return newMockResponse(http.StatusServiceUnavailable, "unavailable"), nil
+	}}
+	p := New(testLogger, client)
+	pod := newMockPod("192.168.100.1")
+
+	_, err := p.GetConfig(context.Background(), pod)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Path != configPath || apiErr.Body != "unavailable" {
+		t.Errorf("unexpected error %#v", apiErr)
+	}
+	if !strings.Contains(err.Error(), "patroni returned '503'") {
+		t.Errorf("expected the status in the error message, got %q", err)
+	}
+
+	err = p.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 40})
+	if !errors.Is(err, &APIError{StatusCode: http.StatusConflict}) {
+		t.Errorf("expected a 409 APIError, got %v", err)
+	}
+	if !errors.Is(err, &APIError{Path: configPath}) {
+		t.Errorf("expected an APIError for %s, got %v", configPath, err)
+	}
+	if errors.Is(err, &APIError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Errorf("expected a 409 not to match 503, got %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		status        int
+		expectedError bool
+	}{
+		{
+			subtest: "reloaded",
+			status:  http.StatusOK,
+		},
+		{
+			subtest: "reload scheduled",
+			status:  http.StatusAccepted,
+		},
+		{
+			subtest:       "reload failed",
+			status:        http.StatusInternalServerError,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		var request *http.Request
+		client := &stubHTTPClient{handler: func(r *http.Request) (*http.Response, error) {
+			request = r
+			return newMockResponse(tt.status, "reload scheduled"), nil
+		}}
+		p := New(testLogger, client)
+
+		err := p.Reload(context.Background(), newMockPod("192.168.100.1"))
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if request.Method != http.MethodPost || request.URL.Path != reloadPath {
+			t.Errorf("%s: expected POST %s, got %s %s", tt.subtest, reloadPath, request.Method, request.URL.Path)
+		}
+	}
+}
+
+func TestMemberDataReplication(t *testing.T) {
+	var testTable = []struct {
+		subtest          string
+		status           string
+		expectedTimeline int
+		expectedState    string
+	}{
+		{
+			subtest:          "leader",
+			status:           `{"state": "running", "role": "master", "timeline": 6, "xlog": {"location": 55978296057856}}`,
+			expectedTimeline: 6,
+		},
+		{
+			subtest:          "streaming replica",
+			status:           `{"state": "running", "role": "replica", "timeline": 6, "replication_state": "streaming", "xlog": {"received_location": 55978296057856, "replayed_location": 55978296057856}}`,
+			expectedTimeline: 6,
+			expectedState:    "streaming",
+		},
+		{
+			subtest:          "replica in archive recovery",
+			status:           `{"state": "running", "role": "replica", "timeline": 5, "replication_state": "in archive recovery"}`,
+			expectedTimeline: 5,
+			expectedState:    "in archive recovery",
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.status), nil
+		}}
+		data, err := New(testLogger, client, WithStrictDecode()).GetMemberData(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if data.Timeline != tt.expectedTimeline || data.ReplicationState != tt.expectedState {
+			t.Errorf("%s: expected timeline %d and state %q, got %d %q", tt.subtest, tt.expectedTimeline, tt.expectedState, data.Timeline, data.ReplicationState)
+		}
+		if data.Lag != nil {
+			t.Errorf("%s: expected no lag for a single member, got %d", tt.subtest, *data.Lag)
+		}
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+	}}
+	p := New(nil, client)
+
+	pod := newMockPod("192.168.100.1")
+	if _, err := p.GetStatus(context.Background(), pod); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := p.GetMemberData(context.Background(), pod); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := p.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 30}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGetMemberDataStatus(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		status        int
+		body          string
+		expectedState string
+		expectedError bool
+	}{
+		{
+			subtest:       "running",
+			status:        http.StatusOK,
+			body:          `{"state": "running", "role": "master"}`,
+			expectedState: "running",
+		},
+		{
+			subtest:       "postgres not running",
+			status:        http.StatusServiceUnavailable,
+			body:          `{"state": "stopped", "role": "replica"}`,
+			expectedState: "stopped",
+		},
+		{
+			subtest:       "internal error",
+			status:        http.StatusInternalServerError,
+			body:          `{}`,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(tt.status, tt.body), nil
+		}}
+		p := New(testLogger, client)
+
+		data, err := p.GetMemberData(context.Background(), newMockPod("192.168.100.1"))
+		if (err != nil) != tt.expectedError {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if tt.expectedError && !errors.Is(err, &APIError{StatusCode: tt.status}) {
+			t.Errorf("%s: expected an API error with status %d, got %v", tt.subtest, tt.status, err)
+		}
+		if data.State != tt.expectedState {
+			t.Errorf("%s: expected state %q, got %q", tt.subtest, tt.expectedState, data.State)
+		}
+	}
+}
+
+func TestIsRestartPending(t *testing.T) {
+	for _, expected := range []bool{true, false} {
+		body := fmt.Sprintf(`{"state": "running", "role": "replica", "pending_restart": %t}`, expected)
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method != http.MethodGet {
+				t.Errorf("unexpected %s request to %s", request.Method, request.URL.Path)
+			}
+			return newMockResponse(http.StatusOK, body), nil
+		}}
+		p := New(testLogger, client)
+
+		pending, err := p.IsRestartPending(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if pending != expected {
+			t.Errorf("expected pending restart %t, got %t", expected, pending)
+		}
+	}
+}
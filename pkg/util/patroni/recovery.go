@@ -0,0 +1,62 @@
+package patroni
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ErrNotReplica is returned when an operation requires a replica, but the
+// member it was sent to is the leader
+var ErrNotReplica = errors.New("member is not a replica")
+
+// RecoveryConfig is the recovery configuration of a standby
+type RecoveryConfig struct {
+	PrimaryConnInfo        string
+	RestoreCommand         string
+	PrimarySlotName        string
+	RecoveryTargetTimeline string
+}
+
+// GetRecoveryConfig would return the recovery settings of a replica. Patroni
+// generates them itself from the leader and the local configuration and
+// reports none of them through the API, the recovery_conf section is local
+// and never part of /config. So it returns ErrNotReplica for the leader and
+// ErrNotSupported for every replica.
+func (p *Patroni) GetRecoveryConfig(ctx context.Context, server *v1.Pod) (RecoveryConfig, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return RecoveryConfig{}, err
+	}
+	if data.IsLeader() {
+		return RecoveryConfig{}, fmt.Errorf("could not get recovery config of %s with role %q: %w", server.Name, data.Role, ErrNotReplica)
+	}
+	return RecoveryConfig{}, fmt.Errorf("could not get recovery config of %s: %w", server.Name, ErrNotSupported)
+}
+
+// Reinitialize rebuilds the data directory of a replica from the leader.
+// Without force Patroni refuses to reinitialize a running replica. The leader
+// is never reinitialized, which is reported as ErrNotReplica.
+func (p *Patroni) Reinitialize(ctx context.Context, server *v1.Pod, force bool) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]bool{"force": force})
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	apiURLString, err := p.apiURL(server)
+	if err != nil {
+		return err
+	}
+	err = p.httpPostOrPatch(ctx, http.MethodPost, apiURLString+reinitPath, buf)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable && strings.Contains(apiErr.Body, "I am the leader") {
+		return fmt.Errorf("could not reinitialize %s: %w", server.Name, ErrNotReplica)
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestGetRecoveryConfig(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		status        string
+		expectedError error
+	}{
+		{
+			subtest:       "replica",
+			status:        `{"state": "running", "role": "replica"}`,
+			expectedError: ErrNotSupported,
+		},
+		{
+			subtest:       "primary",
+			status:        `{"state": "running", "role": "master"}`,
+			expectedError: ErrNotReplica,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.URL.Path == configPath {
+				t.Errorf("%s: unexpected request of the config", tt.subtest)
+			}
+			return newMockResponse(http.StatusOK, tt.status), nil
+		}}
+		p := New(testLogger, client)
+
+		recovery, err := p.GetRecoveryConfig(context.Background(), newMockPod("192.168.100.1"))
+		if !errors.Is(err, tt.expectedError) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if recovery != (RecoveryConfig{}) {
+			t.Errorf("%s: expected no recovery config, got %#v", tt.subtest, recovery)
+		}
+	}
+}
+
+func TestReinitialize(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		force         bool
+		status        int
+		response      string
+		expectedBody  string
+		expectedError error
+	}{
+		{
+			subtest:      "replica",
+			status:       http.StatusOK,
+			response:     "reinitialize started",
+			expectedBody: "{\"force\":false}\n",
+		},
+		{
+			subtest:      "forced",
+			force:        true,
+			status:       http.StatusOK,
+			response:     "reinitialize started",
+			expectedBody: "{\"force\":true}\n",
+		},
+		{
+			subtest:       "leader",
+			status:        http.StatusServiceUnavailable,
+			response:      "I am the leader, can not reinitialize",
+			expectedBody:  "{\"force\":false}\n",
+			expectedError: ErrNotReplica,
+		},
+		{
+			subtest:       "no leader",
+			status:        http.StatusServiceUnavailable,
+			response:      "Cluster has no leader, can not reinitialize",
+			expectedBody:  "{\"force\":false}\n",
+			expectedError: &APIError{StatusCode: http.StatusServiceUnavailable, Path: reinitPath},
+		},
+	}
+	for _, tt := range testTable {
+		var path, body string
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			content, err := ioutil.ReadAll(request.Body)
+			path, body = request.URL.Path, string(content)
+			return newMockResponse(tt.status, tt.response), err
+		}}
+		p := New(testLogger, client)
+
+		err := p.Reinitialize(context.Background(), newMockPod("192.168.100.1"), tt.force)
+		if !errors.Is(err, tt.expectedError) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if path != reinitPath || body != tt.expectedBody {
+			t.Errorf("%s: expected %q posted to %s, got %q to %s", tt.subtest, tt.expectedBody, reinitPath, body, path)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed calls of the Patroni API are retried.
+// Calls are retried on 503 responses, while Patroni rebinds its API, and on
+// connection errors. Non-idempotent requests are only retried if the
+// connection was refused or the host name could not be resolved, e.g. while
+// the DNS record of a recreated pod is not yet published, so they were never
+// received. Other responses, e.g. 400 for an invalid config, fail
+// immediately.
+type RetryPolicy struct {
+	// MaxAttempts including the first one, retries are disabled below 2
+	MaxAttempts int
+	// InitialBackoff before the first retry, doubled for every further one
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time between two attempts
+	MaxBackoff time.Duration
+	// Budget limits the total time spent on a call including all retries,
+	// unlimited if zero
+	Budget time.Duration
+	// Sleep waits between attempts, it can be replaced in tests. By default
+	// it waits for the backoff or until the context is done.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// DefaultRetryPolicy rides out the restart of the Patroni API during
+// rolling restarts
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Budget:         30 * time.Second,
+	}
+}
+
+// backoff returns the wait before the given retry, with the upper half
+// randomized so that concurrent clients spread their retries
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	d := r.InitialBackoff
+	for i := 1; i < retry && (r.MaxBackoff == 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable tells whether a failed attempt may be repeated. The status is
+// zero if there was no response.
+func retryable(method string, status int, err error) bool {
+	idempotent := method == http.MethodGet || method == http.MethodPatch
+	if status != 0 {
+		return status == http.StatusServiceUnavailable && idempotent
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return idempotent || errors.Is(err, syscall.ECONNREFUSED) || isDNSError(err)
+}
+
+// isDNSError tells whether the request failed to resolve the host name
+func isDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// RetryAbortedError is returned when the context is done while waiting for
+// the next attempt. It unwraps to the error of the last attempt and also
+// matches the error of the context, e.g. context.Canceled.
+type RetryAbortedError struct {
+	Attempts int
+	Err      error
+	Cause    error
+}
+
+func (e *RetryAbortedError) Error() string {
+	return fmt.Sprintf("retry aborted after %d attempts: %v, last error: %v", e.Attempts, e.Cause, e.Err)
+}
+
+func (e *RetryAbortedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryAbortedError) Is(target error) bool {
+	return errors.Is(e.Cause, target)
+}
+
+// withRetry runs the attempt until it succeeds, fails permanently or the
+// retry policy is exhausted, and returns the error of the last attempt. If
+// the context is done before the next attempt a RetryAbortedError is
+// returned instead.
+func (p *Patroni) withRetry(ctx context.Context, method string, url string, attempt func() (int, error)) error {
+	start := time.Now()
+	for retry := 1; ; retry++ {
+		status, err := attempt()
+		if err == nil || retry >= p.retryPolicy.MaxAttempts || !retryable(method, status, err) {
+			return err
+		}
+
+		wait := p.retryPolicy.backoff(retry)
+		if p.retryPolicy.Budget > 0 && time.Since(start)+wait > p.retryPolicy.Budget {
+			return err
+		}
+		if p.logger != nil {
+			p.logger.Debugf("retrying %s %s in %v: %v", method, url, wait, err)
+		}
+		sleepFunc := p.retryPolicy.Sleep
+		if sleepFunc == nil {
+			sleepFunc = sleep
+		}
+		if sleepErr := sleepFunc(ctx, wait); sleepErr != nil {
+			return &RetryAbortedError{Attempts: retry, Err: err, Cause: sleepErr}
+		}
+	}
+}
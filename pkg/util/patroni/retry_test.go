@@ -0,0 +1,295 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// noSleepPolicy retries without waiting and records the backoffs
+func noSleepPolicy(attempts int, waits *[]time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			*waits = append(*waits, d)
+			return nil
+		},
+	}
+}
+
+func connectionRefused() error {
+	return &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}
+}
+
+// hostNotFound fails like a lookup of a pod whose DNS record is not yet
+// published
+func hostNotFound() error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "acid-test-0.acid-test", IsNotFound: true}}
+}
+
+func TestRetry(t *testing.T) {
+	var testTable = []struct {
+		subtest          string
+		call             func(p *Patroni) error
+		failures         []func() (*http.Response, error)
+		expectedAttempts int
+		expectedError    bool
+	}{
+		{
+			subtest: "GET retried on 503",
+			call: func(p *Patroni) error {
+				_, err := p.GetConfig(context.Background(), newMockPod("192.168.100.1"))
+				return err
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) {
+					return newMockResponse(http.StatusServiceUnavailable, "restarting"), nil
+				},
+				func() (*http.Response, error) { return nil, errors.New("connection reset by peer") },
+			},
+			expectedAttempts: 3,
+		},
+		{
+			subtest: "PATCH retried on 503",
+			call: func(p *Patroni) error {
+				return p.SetConfig(context.Background(), newMockPod("192.168.100.1"), map[string]interface{}{"ttl": 30})
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) {
+					return newMockResponse(http.StatusServiceUnavailable, "restarting"), nil
+				},
+			},
+			expectedAttempts: 2,
+		},
+		{
+			subtest: "PATCH not retried on 400",
+			call: func(p *Patroni) error {
+				return p.SetConfig(context.Background(), newMockPod("192.168.100.1"), map[string]interface{}{"ttl": "x"})
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) { return newMockResponse(http.StatusBadRequest, "invalid config"), nil },
+			},
+			expectedAttempts: 1,
+			expectedError:    true,
+		},
+		{
+			subtest: "POST retried on refused connection",
+			call: func(p *Patroni) error {
+				return p.Switchover(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), "acid-test-1")
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, connectionRefused() },
+			},
+			expectedAttempts: 2,
+		},
+		{
+			subtest: "POST retried until the host name resolves",
+			call: func(p *Patroni) error {
+				return p.Switchover(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), "acid-test-1")
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, hostNotFound() },
+				func() (*http.Response, error) { return nil, hostNotFound() },
+			},
+			expectedAttempts: 3,
+		},
+		{
+			subtest: "POST not retried on other connection errors",
+			call: func(p *Patroni) error {
+				return p.Switchover(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), "acid-test-1")
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, errors.New("connection reset by peer") },
+			},
+			expectedAttempts: 1,
+			expectedError:    true,
+		},
+		{
+			subtest: "member data retried on refused connection",
+			call: func(p *Patroni) error {
+				_, err := p.GetMemberData(context.Background(), newMockPod("192.168.100.1"))
+				return err
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, connectionRefused() },
+			},
+			expectedAttempts: 2,
+		},
+		{
+			subtest: "attempts exhausted",
+			call: func(p *Patroni) error {
+				_, err := p.GetConfig(context.Background(), newMockPod("192.168.100.1"))
+				return err
+			},
+			failures: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, connectionRefused() },
+				func() (*http.Response, error) { return nil, connectionRefused() },
+				func() (*http.Response, error) { return nil, connectionRefused() },
+				func() (*http.Response, error) { return nil, connectionRefused() },
+			},
+			expectedAttempts: 4,
+			expectedError:    true,
+		},
+	}
+	for _, tt := range testTable {
+		var waits []time.Duration
+		attempts := 0
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts <= len(tt.failures) {
+				return tt.failures[attempts-1]()
+			}
+			return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+		}}
+		p := New(testLogger, client, WithRetryPolicy(noSleepPolicy(4, &waits)))
+
+		err := tt.call(p)
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if attempts != tt.expectedAttempts {
+			t.Errorf("%s: expected %d attempts, got %d", tt.subtest, tt.expectedAttempts, attempts)
+		}
+		if len(waits) != tt.expectedAttempts-1 {
+			t.Errorf("%s: expected %d waits, got %v", tt.subtest, tt.expectedAttempts-1, waits)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var waits []time.Duration
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return nil, connectionRefused()
+	}}
+	p := New(testLogger, client, WithRetryPolicy(noSleepPolicy(5, &waits)))
+
+	if _, err := p.GetConfig(context.Background(), newMockPod("192.168.100.1")); err == nil {
+		t.Fatal("expected an error")
+	}
+	bounds := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	if len(waits) != len(bounds) {
+		t.Fatalf("expected %d waits, got %v", len(bounds), waits)
+	}
+	for i, wait := range waits {
+		if wait < bounds[i]/2 || wait > bounds[i] {
+			t.Errorf("expected wait %d between %v and %v, got %v", i, bounds[i]/2, bounds[i], wait)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	attempts := 0
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		attempts++
+		return newMockResponse(http.StatusServiceUnavailable, "restarting"), nil
+	}}
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		Budget:         30 * time.Millisecond,
+	}
+	p := New(testLogger, client, WithRetryPolicy(policy))
+
+	_, err := p.GetConfig(context.Background(), newMockPod("192.168.100.1"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts < 2 || attempts > 3 {
+		t.Errorf("expected the budget to allow 2 or 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		attempts++
+		return newMockResponse(http.StatusServiceUnavailable, "restarting"), nil
+	}}
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Hour,
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			if attempts == 2 {
+				cancel()
+			}
+			return sleep(ctx, time.Millisecond)
+		},
+	}
+	p := New(testLogger, client, WithRetryPolicy(policy))
+
+	_, err := p.GetConfig(ctx, newMockPod("192.168.100.1"))
+	var aborted *RetryAbortedError
+	if !errors.As(err, &aborted) || aborted.Attempts != 2 {
+		t.Fatalf("expected retry to be aborted after 2 attempts, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to match %v, got %v", context.Canceled, err)
+	}
+	if !errors.Is(err, &APIError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Errorf("expected error to wrap the last 503, got %v", err)
+	}
+	if message := err.Error(); !strings.Contains(message, "2 attempts") || !strings.Contains(message, "restarting") {
+		t.Errorf("expected error to mention the attempts and the last error, got %q", message)
+	}
+}
+
+func TestNoRetryByDefault(t *testing.T) {
+	attempts := 0
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, fmt.Errorf("dial tcp: %w", connectionRefused())
+	}}
+	p := New(testLogger, client)
+
+	if _, err := p.GetConfig(context.Background(), newMockPod("192.168.100.1")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	var keys []string
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		keys = append(keys, request.Header.Get(idempotencyKeyHeader))
+		if len(keys)%2 == 1 {
+			return nil, connectionRefused()
+		}
+		return newMockResponse(http.StatusOK, "{}"), nil
+	}}
+	var waits []time.Duration
+	p := New(testLogger, client, WithRetryPolicy(noSleepPolicy(2, &waits)), WithIdempotencyKeys())
+	master := newMockNamedPod("acid-test-0", "192.168.100.1")
+
+	for i := 0; i < 2; i++ {
+		if err := p.Switchover(context.Background(), master, "acid-test-1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(keys) != 4 {
+		t.Fatalf("expected 4 attempts, got %v", keys)
+	}
+	if keys[0] == "" || keys[0] != keys[1] || keys[2] != keys[3] {
+		t.Errorf("expected the key to be reused for retries, got %v", keys)
+	}
+	if keys[0] == keys[2] {
+		t.Errorf("expected a new key for every operation, got %v", keys)
+	}
+
+	keys = nil
+	if err := New(testLogger, client).Switchover(context.Background(), master, "acid-test-1"); err == nil || keys[0] != "" {
+		t.Errorf("expected no key without the option, got %v", keys)
+	}
+}
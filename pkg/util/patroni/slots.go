@@ -0,0 +1,152 @@
+package patroni
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// SlotConfig is a permanent replication slot in the Patroni config
+type SlotConfig struct {
+	Type     string `json:"type"`
+	Database string `json:"database,omitempty"`
+	Plugin   string `json:"plugin,omitempty"`
+}
+
+// defaultMaxReplicationSlots is the Postgres default of max_replication_slots
+const defaultMaxReplicationSlots = 10
+
+// getSlots reads the permanent slots from the config
+func getSlots(config map[string]interface{}) (map[string]SlotConfig, error) {
+	slots := make(map[string]SlotConfig)
+	section, ok := config["slots"]
+	if !ok || section == nil {
+		return slots, nil
+	}
+	if err := decodeConfigSection(section, &slots); err != nil {
+		return nil, fmt.Errorf("could not parse slots: %v", err)
+	}
+	return slots, nil
+}
+
+// ReconcileSlots makes the permanent slots match desired with a single PATCH.
+// Missing slots are created and changed ones updated. Slots absent from
+// desired are removed only if they are managed, i.e. named WithManagedSlots
+// or created by an earlier ReconcileSlots call of this client, so slots
+// created by others are left alone.
+func (p *Patroni) ReconcileSlots(ctx context.Context, server *v1.Pod, desired map[string]SlotConfig) error {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return err
+	}
+	current, err := getSlots(config)
+	if err != nil {
+		return err
+	}
+
+	// the lock is not held during the PATCH, which may verify the leader and
+	// so take the lock itself
+	p.mu.Lock()
+	patch := make(map[string]interface{})
+	for name, slot := range desired {
+		if existing, ok := current[name]; !ok || existing != slot {
+			patch[name] = slot
+		}
+	}
+	for name := range current {
+		if _, ok := desired[name]; !ok && p.managedSlots[name] {
+			patch[name] = nil
+		}
+	}
+	p.mu.Unlock()
+	if len(patch) == 0 {
+		return nil
+	}
+
+	if err := p.SetConfig(ctx, server, map[string]interface{}{"slots": patch}); err != nil {
+		return fmt.Errorf("could not reconcile slots: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, slot := range patch {
+		if slot == nil {
+			delete(p.managedSlots, name)
+		} else {
+			p.managedSlots[name] = true
+		}
+	}
+	return nil
+}
+
+// GetMaxReplicationSlots returns max_replication_slots of the member, which
+// limits the number of physical and logical slots together
+func (p *Patroni) GetMaxReplicationSlots(ctx context.Context, server *v1.Pod) (int, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := lookupConfig(config, "postgresql", "parameters", "max_replication_slots")
+	if !ok {
+		return defaultMaxReplicationSlots, nil
+	}
+	maxSlots, err := strconv.Atoi(fmt.Sprintf("%v", value))
+	if err != nil {
+		return 0, fmt.Errorf("could not parse max_replication_slots %v: %v", value, err)
+	}
+	return maxSlots, nil
+}
+
+// memberSlotName returns the name of the physical slot Patroni uses for a
+// member, i.e. the member name lowercased with invalid characters replaced
+func memberSlotName(member string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(member))
+}
+
+// OrphanedSlots returns the sorted names of the physical permanent slots in
+// the config which no streaming member of the cluster replicates from. Such
+// slots retain WAL on the leader and are candidates for removal. Logical
+// slots are consumed by clients outside the cluster and slots owned by this
+// client, see WithManagedSlots, are intentional, so neither is reported.
+func (p *Patroni) OrphanedSlots(ctx context.Context, server *v1.Pod) ([]string, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := getSlots(config)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, member := range cluster.Members {
+		if !member.isLeader() && (member.State == "streaming" || member.State == "running") {
+			used[memberSlotName(member.Name)] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	orphaned := []string{}
+	for name, slot := range slots {
+		if slot.Type == "logical" || used[name] || p.managedSlots[name] {
+			continue
+		}
+		orphaned = append(orphaned, name)
+	}
+	sort.Strings(orphaned)
+	return orphaned, nil
+}
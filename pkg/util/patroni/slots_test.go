@@ -0,0 +1,184 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetMaxReplicationSlots(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		config        string
+		expected      int
+		expectedError bool
+	}{
+		{
+			subtest:  "configured",
+			config:   `{"postgresql": {"parameters": {"max_replication_slots": 20}}}`,
+			expected: 20,
+		},
+		{
+			subtest:  "configured as string",
+			config:   `{"postgresql": {"parameters": {"max_replication_slots": "5"}}}`,
+			expected: 5,
+		},
+		{
+			subtest:  "default",
+			config:   `{"postgresql": {"parameters": {"max_connections": 100}}}`,
+			expected: 10,
+		},
+		{
+			subtest:       "invalid",
+			config:        `{"postgresql": {"parameters": {"max_replication_slots": "many"}}}`,
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.config), nil
+		}}
+		p := New(testLogger, client)
+
+		maxSlots, err := p.GetMaxReplicationSlots(context.Background(), newMockPod("192.168.100.1"))
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if maxSlots != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.subtest, tt.expected, maxSlots)
+		}
+	}
+}
+
+func TestOrphanedSlots(t *testing.T) {
+	config := `{"slots": {
+		"acid_test_1": {"type": "physical"},
+		"acid_test_2": {"type": "physical"},
+		"standby_cluster": {"type": "physical"},
+		"old_replica": {"type": "physical"},
+		"cdc": {"type": "logical", "database": "app", "plugin": "pgoutput"}
+	}}`
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running"},
+		{"name": "acid-test-1", "role": "replica", "state": "streaming"},
+		{"name": "acid-test-2", "role": "replica", "state": "stopped"}
+	]}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		if request.URL.Path == clusterPath {
+			return newMockResponse(http.StatusOK, cluster), nil
+		}
+		return newMockResponse(http.StatusOK, config), nil
+	}}
+	p := New(testLogger, client, WithManagedSlots("standby_cluster"))
+
+	orphaned, err := p.OrphanedSlots(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"acid_test_2", "old_replica"}; !reflect.DeepEqual(orphaned, expected) {
+		t.Errorf("expected orphaned slots %v, got %v", expected, orphaned)
+	}
+}
+
+func TestReconcileSlots(t *testing.T) {
+	config := `{"slots": {
+		"cdc": {"type": "logical", "database": "app", "plugin": "pgoutput"},
+		"standby": {"type": "physical"},
+		"external": {"type": "physical"}
+	}}`
+
+	var testTable = []struct {
+		subtest       string
+		options       []Option
+		desired       map[string]SlotConfig
+		expectedPatch map[string]interface{}
+	}{
+		{
+			subtest: "create slot",
+			options: []Option{WithManagedSlots("cdc", "standby")},
+			desired: map[string]SlotConfig{
+				"cdc":     {Type: "logical", Database: "app", Plugin: "pgoutput"},
+				"standby": {Type: "physical"},
+				"archive": {Type: "physical"},
+			},
+			expectedPatch: map[string]interface{}{"slots": map[string]interface{}{
+				"archive": map[string]interface{}{"type": "physical"},
+			}},
+		},
+		{
+			subtest: "update slot",
+			options: []Option{WithManagedSlots("cdc", "standby")},
+			desired: map[string]SlotConfig{
+				"cdc":     {Type: "logical", Database: "app", Plugin: "wal2json"},
+				"standby": {Type: "physical"},
+			},
+			expectedPatch: map[string]interface{}{"slots": map[string]interface{}{
+				"cdc": map[string]interface{}{"type": "logical", "database": "app", "plugin": "wal2json"},
+			}},
+		},
+		{
+			subtest: "delete managed slot and leave external slot alone",
+			options: []Option{WithManagedSlots("cdc", "standby")},
+			desired: map[string]SlotConfig{
+				"cdc": {Type: "logical", Database: "app", Plugin: "pgoutput"},
+			},
+			expectedPatch: map[string]interface{}{"slots": map[string]interface{}{
+				"standby": nil,
+			}},
+		},
+		{
+			subtest: "unchanged",
+			options: []Option{WithManagedSlots("cdc", "standby")},
+			desired: map[string]SlotConfig{
+				"cdc":     {Type: "logical", Database: "app", Plugin: "pgoutput"},
+				"standby": {Type: "physical"},
+			},
+		},
+		{
+			subtest: "leader required",
+			options: []Option{WithManagedSlots("cdc", "standby"), WithRequireLeader()},
+			desired: map[string]SlotConfig{
+				"cdc": {Type: "logical", Database: "app", Plugin: "pgoutput"},
+			},
+			expectedPatch: map[string]interface{}{"slots": map[string]interface{}{
+				"standby": nil,
+			}},
+		},
+	}
+	for _, tt := range testTable {
+		var patched map[string]interface{}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			switch {
+			case request.Method == http.MethodPatch:
+				if err := json.NewDecoder(request.Body).Decode(&patched); err != nil {
+					t.Fatalf("%s: could not decode patch: %v", tt.subtest, err)
+				}
+				return newMockResponse(http.StatusOK, "{}"), nil
+			case request.URL.Path == configPath:
+				return newMockResponse(http.StatusOK, config), nil
+			default:
+				return newMockResponse(http.StatusOK, `{"state": "running", "role": "master", "patroni": {"version": "3.0.2"}}`), nil
+			}
+		}}
+		p := New(testLogger, client, tt.options...)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- p.ReconcileSlots(context.Background(), newMockPod("192.168.100.1"), tt.desired)
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: reconciling slots did not return", tt.subtest)
+		}
+		if !reflect.DeepEqual(patched, tt.expectedPatch) {
+			t.Errorf("%s: expected patch %v, got %v", tt.subtest, tt.expectedPatch, patched)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultSwitchoverTimeout = 5 * time.Minute
+
+	// readOnlyParameter makes new transactions read-only while draining
+	readOnlyParameter = "default_transaction_read_only"
+)
+
+var (
+	// ErrNoCandidate is returned when no member is eligible for promotion
+	ErrNoCandidate = errors.New("no switchover candidate available")
+	// ErrSwitchoverCooldown is returned when the previous switchover of the
+	// cluster happened less than the configured cooldown ago
+	ErrSwitchoverCooldown = errors.New("switchover cooldown has not expired")
+	// ErrNoNewLeader is returned when no new leader was elected in time
+	ErrNoNewLeader = errors.New("no new leader elected")
+	// ErrInvalidSchedule is returned when the time of a scheduled switchover
+	// is not in the future
+	ErrInvalidSchedule = errors.New("invalid switchover schedule")
+	// ErrOutsideWindow is returned when a switchover is requested outside
+	// of the allowed time window
+	ErrOutsideWindow = errors.New("outside of switchover window")
+)
+
+// SwitchoverOutcome is a machine readable result of a switchover, suitable
+// as reason of Kubernetes conditions and events
+type SwitchoverOutcome string
+
+// Possible switchover outcomes
+const (
+	SwitchoverPromoted    SwitchoverOutcome = "Promoted"
+	SwitchoverNoCandidate SwitchoverOutcome = "NoCandidate"
+	SwitchoverRejected    SwitchoverOutcome = "Rejected"
+	SwitchoverTimeout     SwitchoverOutcome = "Timeout"
+)
+
+// SwitchoverOptions controls SafeSwitchover
+type SwitchoverOptions struct {
+	// Candidate to promote, chosen automatically if empty
+	Candidate string
+	// Cooldown is the minimal time between two switchovers of a cluster
+	Cooldown time.Duration
+	// Timeout to wait for the new leader after the switchover was accepted
+	Timeout time.Duration
+	// PollInterval between member data reads while waiting for the new
+	// leader, the poll interval of the client if zero
+	PollInterval time.Duration
+}
+
+// GetMembersData reads member data of all given pods, keyed by pod name.
+// If the leader is among them, the lag of the replicas is set. Pods that
+// could not be queried are reported in the returned error map.
+func (p *Patroni) GetMembersData(ctx context.Context, servers []*v1.Pod) (map[string]MemberData, map[string]error) {
+	members := make(map[string]MemberData, len(servers))
+	errs := make(map[string]error)
+	for _, server := range servers {
+		data, err := p.GetMemberData(ctx, server)
+		if err != nil {
+			errs[server.Name] = err
+			continue
+		}
+		members[server.Name] = data
+	}
+	setReplicationLag(members)
+	return members, errs
+}
+
+// setReplicationLag sets the lag of all replicas reporting their replayed
+// location relative to the leader's location, if there is a leader
+func setReplicationLag(members map[string]MemberData) {
+	var leader *MemberData
+	for _, data := range members {
+		if data.IsLeader() {
+			data := data
+			leader = &data
+		}
+	}
+	if leader == nil {
+		return
+	}
+	for name, data := range members {
+		if data.IsLeader() || data.Xlog.ReplayedLocation == 0 {
+			continue
+		}
+		lag := leader.Xlog.Location - data.Xlog.ReplayedLocation
+		if lag < 0 {
+			lag = 0
+		}
+		data.Lag = &lag
+		members[name] = data
+	}
+}
+
+// CheckSwitchoverPreconditions verifies that the master holds the leader lock
+// and is running, so that Patroni will accept a switchover away from it
+func CheckSwitchoverPreconditions(master *v1.Pod, members map[string]MemberData) error {
+	data, ok := members[master.Name]
+	if !ok {
+		return fmt.Errorf("no member data for master %s", master.Name)
+	}
+	if !data.IsLeader() {
+		return fmt.Errorf("%s has role %q: %w", master.Name, data.Role, ErrNotLeader)
+	}
+	if data.State != "running" {
+		return fmt.Errorf("master %s is not running, but %q", master.Name, data.State)
+	}
+	if data.ClusterUnlocked {
+		return fmt.Errorf("cluster of %s has no leader lock", master.Name)
+	}
+	return nil
+}
+
+// ChooseSwitchoverCandidate picks the running replica which has replayed the
+// most WAL. Ties are resolved by the failover priority tag and then by member
+// name to keep the choice stable. Members with priority 0 are never chosen.
+func ChooseSwitchoverCandidate(master *v1.Pod, members map[string]MemberData) (string, error) {
+	var candidates []string
+	for name, data := range members {
+		if name == master.Name || data.IsLeader() || data.State != "running" || failoverPriority(data.Tags) == 0 {
+			continue
+		}
+		candidates = append(candidates, name)
+	}
+	if len(candidates) == 0 {
+		return "", ErrNoCandidate
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		left, right := members[candidates[i]], members[candidates[j]]
+		if left.Xlog.ReplayedLocation != right.Xlog.ReplayedLocation {
+			return left.Xlog.ReplayedLocation > right.Xlog.ReplayedLocation
+		}
+		if leftPriority, rightPriority := failoverPriority(left.Tags), failoverPriority(right.Tags); leftPriority != rightPriority {
+			return leftPriority > rightPriority
+		}
+		return candidates[i] < candidates[j]
+	})
+	return candidates[0], nil
+}
+
+// RankingFactors are the properties of a replica which RankCandidates weighs
+type RankingFactors struct {
+	// LagBytes is the WAL the replica has yet to replay compared to the
+	// master's current location
+	LagBytes         int64
+	SyncStandby      bool
+	TimelineMatch    bool
+	FailoverPriority int
+}
+
+// RankedCandidate is a replica eligible for promotion with its score
+type RankedCandidate struct {
+	Name    string
+	Score   int
+	Factors RankingFactors
+}
+
+// RankCandidates orders the replicas eligible for promotion from best to
+// worst. Being on the master's timeline counts 40 points, being a
+// synchronous standby 20, replication lag up to 30 with one point lost per
+// MiB of lag, and the failover priority up to 10. Unknown timelines are not
+// penalized. Equal scores are ordered by failover priority and then by name.
+func RankCandidates(master *v1.Pod, members map[string]MemberData) ([]RankedCandidate, error) {
+	leader, ok := members[master.Name]
+	if !ok {
+		return nil, fmt.Errorf("no member data for master %s", master.Name)
+	}
+
+	var ranked []RankedCandidate
+	for name, data := range members {
+		priority := failoverPriority(data.Tags)
+		if name == master.Name || data.IsLeader() || data.State != "running" || priority == 0 {
+			continue
+		}
+		factors := RankingFactors{
+			LagBytes:         leader.Xlog.Location - data.Xlog.ReplayedLocation,
+			SyncStandby:      data.SyncStandby,
+			TimelineMatch:    leader.Timeline == 0 || data.Timeline == 0 || leader.Timeline == data.Timeline,
+			FailoverPriority: priority,
+		}
+		if factors.LagBytes < 0 {
+			factors.LagBytes = 0
+		}
+		ranked = append(ranked, RankedCandidate{Name: name, Score: factors.score(), Factors: factors})
+	}
+	if len(ranked) == 0 {
+		return nil, ErrNoCandidate
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		if ranked[i].Factors.FailoverPriority != ranked[j].Factors.FailoverPriority {
+			return ranked[i].Factors.FailoverPriority > ranked[j].Factors.FailoverPriority
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	return ranked, nil
+}
+
+func (f RankingFactors) score() int {
+	score := 0
+	if f.TimelineMatch {
+		score += 40
+	}
+	if f.SyncStandby {
+		score += 20
+	}
+	if lagMiB := f.LagBytes >> 20; lagMiB < 30 {
+		score += 30 - int(lagMiB)
+	}
+	if f.FailoverPriority < 10 {
+		score += f.FailoverPriority
+	} else {
+		score += 10
+	}
+	return score
+}
+
+// WaitForNewLeader polls the given pods until one other than the previous
+// leader reports the leader role within the timeout and returns its name
+func (p *Patroni) WaitForNewLeader(ctx context.Context, servers []*v1.Pod, previous string, timeout time.Duration) (string, error) {
+	return p.waitForNewLeader(ctx, servers, previous, timeout, p.pollInterval)
+}
+
+func (p *Patroni) waitForNewLeader(ctx context.Context, servers []*v1.Pod, previous string, timeout time.Duration, interval time.Duration) (string, error) {
+	deadline := p.clock.Now().Add(timeout)
+	for {
+		members, _ := p.GetMembersData(ctx, servers)
+		for name, data := range members {
+			if name != previous && data.IsLeader() && data.State == "running" {
+				return name, nil
+			}
+		}
+
+		if p.clock.Now().After(deadline) {
+			return "", fmt.Errorf("%w within %v after switchover from %s", ErrNoNewLeader, timeout, previous)
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return "", fmt.Errorf("%w after switchover from %s: %v", ErrNoNewLeader, previous, err)
+		}
+	}
+}
+
+// SafeSwitchover performs a complete switchover away from the master: it
+// checks preconditions, picks a candidate unless one is given, refuses a
+// candidate on another timeline than the master, enforces the cooldown,
+// triggers the switchover and waits for the new leader, which is returned.
+// The switchover is not refused if a timeline is unknown.
+func (p *Patroni) SafeSwitchover(ctx context.Context, master *v1.Pod, servers []*v1.Pod, opts SwitchoverOptions) (string, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultSwitchoverTimeout
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = p.pollInterval
+	}
+
+	members, errs := p.GetMembersData(ctx, servers)
+	if err, ok := errs[master.Name]; ok {
+		return "", fmt.Errorf("could not get member data of master %s: %v", master.Name, err)
+	}
+	if err := CheckSwitchoverPreconditions(master, members); err != nil {
+		return "", fmt.Errorf("switchover preconditions not met: %w", err)
+	}
+
+	candidate := opts.Candidate
+	if candidate == "" {
+		var err error
+		if candidate, err = ChooseSwitchoverCandidate(master, members); err != nil {
+			return "", err
+		}
+	} else if data, ok := members[candidate]; !ok || data.State != "running" {
+		return "", fmt.Errorf("candidate %s is not a running member: %w", candidate, ErrNoCandidate)
+	}
+	match, err := p.TimelinesMatch(ctx, master, candidate)
+	switch {
+	case errors.Is(err, ErrNotSupported):
+		// like in the ranking of candidates, an unknown timeline does not
+		// block the switchover
+		if p.logger != nil {
+			p.logger.Warningf("could not compare the timelines of %s and %s: %v", master.Name, candidate, err)
+		}
+	case err != nil:
+		return "", fmt.Errorf("could not compare the timelines of %s and %s: %v", master.Name, candidate, err)
+	case !match:
+		return "", fmt.Errorf("candidate %s is on another timeline than the leader: %w", candidate, ErrNoCandidate)
+	}
+
+	scope := members[master.Name].Patroni.Scope
+	release, err := p.reserveSwitchover(scope, opts.Cooldown)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.Switchover(ctx, master, candidate); err != nil {
+		release()
+		return "", fmt.Errorf("could not switch over from %s to %s: %v", master.Name, candidate, err)
+	}
+
+	return p.waitForNewLeader(ctx, servers, master.Name, opts.Timeout, opts.PollInterval)
+}
+
+// reserveSwitchover records a switchover of the cluster, unless the previous
+// one is more recent than the cooldown. The returned function releases the
+// reservation again if the switchover failed, so it can be retried.
+func (p *Patroni) reserveSwitchover(scope string, cooldown time.Duration) (func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clock.Now()
+	last, ok := p.lastSwitchover[scope]
+	if ok && now.Sub(last) < cooldown {
+		return nil, fmt.Errorf("last switchover of %q was at %s: %w", scope, last.Format(time.RFC3339), ErrSwitchoverCooldown)
+	}
+	p.lastSwitchover[scope] = now
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if ok {
+			p.lastSwitchover[scope] = last
+		} else {
+			delete(p.lastSwitchover, scope)
+		}
+	}, nil
+}
+
+// SwitchoverWithOutcome runs SafeSwitchover and classifies its result. Every
+// failure which is neither a missing candidate nor a timeout, including unmet
+// preconditions and the cooldown, is reported as rejected.
+func (p *Patroni) SwitchoverWithOutcome(ctx context.Context, master *v1.Pod, servers []*v1.Pod, opts SwitchoverOptions) (string, SwitchoverOutcome, error) {
+	leader, err := p.SafeSwitchover(ctx, master, servers, opts)
+	switch {
+	case err == nil:
+		return leader, SwitchoverPromoted, nil
+	case errors.Is(err, ErrNoCandidate):
+		return "", SwitchoverNoCandidate, err
+	case errors.Is(err, ErrNoNewLeader):
+		return "", SwitchoverTimeout, err
+	default:
+		return "", SwitchoverRejected, err
+	}
+}
+
+// SwitchoverWithDrain makes the cluster default to read-only transactions,
+// waits for the drain period so running transactions can finish, and then
+// switches over to the candidate. Since the setting is part of the dynamic
+// configuration, it is restored afterwards whether or not the switchover
+// succeeded, so the new leader accepts writes. Restoring does not use ctx, so
+// it happens even if ctx is cancelled during the drain period, in which case
+// there is no switchover.
+func (p *Patroni) SwitchoverWithDrain(ctx context.Context, master *v1.Pod, candidate string, drain time.Duration) error {
+	config, err := p.GetConfig(ctx, master)
+	if err != nil {
+		return fmt.Errorf("could not read config of %s: %v", master.Name, err)
+	}
+	previous, _ := lookupConfig(config, "postgresql", "parameters", readOnlyParameter)
+
+	if err := p.SetPostgresParameters(ctx, master, map[string]string{readOnlyParameter: "on"}); err != nil {
+		return fmt.Errorf("could not make %s read-only: %v", master.Name, err)
+	}
+	switchoverErr := sleep(ctx, drain)
+	if switchoverErr == nil {
+		switchoverErr = p.Switchover(ctx, master, candidate)
+	}
+	restore := map[string]interface{}{
+		"postgresql": map[string]interface{}{
+			"parameters": map[string]interface{}{readOnlyParameter: previous},
+		},
+	}
+	// the old master is no longer the leader, so the leader check is skipped
+	restoreErr := p.patchConfig(context.Background(), master, restore)
+
+	if switchoverErr != nil {
+		if restoreErr != nil {
+			return fmt.Errorf("could not switch over from %s to %s: %v, could not restore %s: %v", master.Name, candidate, switchoverErr, readOnlyParameter, restoreErr)
+		}
+		return fmt.Errorf("could not switch over from %s to %s: %v", master.Name, candidate, switchoverErr)
+	}
+	if restoreErr != nil {
+		return fmt.Errorf("switched over to %s, but could not restore %s: %v", candidate, readOnlyParameter, restoreErr)
+	}
+	return nil
+}
+
+// TimeWindow is a daily time window, given as offsets from midnight. A
+// window with an end before its start spans midnight, one with equal start
+// and end covers the whole day.
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+	// Location of the offsets, UTC if nil
+	Location *time.Location
+}
+
+// Contains tells whether t falls within the window, which includes the
+// start but not the end
+func (w TimeWindow) Contains(t time.Time) bool {
+	location := w.Location
+	if location == nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	offset := t.Sub(midnight)
+
+	switch {
+	case w.Start == w.End:
+		return true
+	case w.Start < w.End:
+		return offset >= w.Start && offset < w.End
+	default:
+		return offset >= w.Start || offset < w.End
+	}
+}
+
+func (w TimeWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return format(w.Start) + "-" + format(w.End)
+}
+
+// SwitchoverInWindow switches over like Switchover, but only if the current
+// time is within the window. Otherwise ErrOutsideWindow is returned without
+// contacting Patroni.
+func (p *Patroni) SwitchoverInWindow(ctx context.Context, master *v1.Pod, candidate string, window TimeWindow) error {
+	if now := p.clock.Now(); !window.Contains(now) {
+		return fmt.Errorf("could not switch over at %s, allowed %s: %w", now.Format(time.RFC3339), window, ErrOutsideWindow)
+	}
+	return p.Switchover(ctx, master, candidate)
+}
+
+// TimelinesMatch tells whether the candidate is on the same timeline as the
+// master. A candidate on another timeline follows a different history and
+// must not be promoted. ErrNotSupported is returned if a timeline is not
+// reported.
+func (p *Patroni) TimelinesMatch(ctx context.Context, master *v1.Pod, candidate string) (bool, error) {
+	data, err := p.GetMemberData(ctx, master)
+	if err != nil {
+		return false, err
+	}
+	cluster, err := p.getCluster(ctx, master)
+	if err != nil {
+		return false, err
+	}
+	for _, member := range cluster.Members {
+		if member.Name != candidate {
+			continue
+		}
+		if data.Timeline == 0 || member.Timeline == 0 {
+			return false, fmt.Errorf("timeline of %s or %s is unknown: %w", master.Name, candidate, ErrNotSupported)
+		}
+		return data.Timeline == member.Timeline, nil
+	}
+	return false, fmt.Errorf("%s is not a member of the cluster of %s", candidate, master.Name)
+}
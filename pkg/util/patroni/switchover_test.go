@@ -0,0 +1,710 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// fakeCluster emulates the Patroni API of a cluster of pods
+type fakeCluster struct {
+	sync.Mutex
+	pods        []*v1.Pod
+	members     map[string]MemberData
+	rejectPosts bool
+	failPosts   map[string]bool
+	promote     bool
+	posts       []string
+}
+
+func newFakeCluster() *fakeCluster {
+	c := &fakeCluster{
+		members:   make(map[string]MemberData),
+		failPosts: make(map[string]bool),
+		promote:   true,
+	}
+	c.add("acid-test-0", "10.0.0.1", MemberData{State: "running", Role: "master", Timeline: 1, Xlog: MemberDataXlog{Location: 300}})
+	c.add("acid-test-1", "10.0.0.2", MemberData{State: "running", Role: "replica", Timeline: 1, Xlog: MemberDataXlog{ReplayedLocation: 200}})
+	c.add("acid-test-2", "10.0.0.3", MemberData{State: "running", Role: "replica", Timeline: 1, Xlog: MemberDataXlog{ReplayedLocation: 300}})
+	return c
+}
+
+func (c *fakeCluster) add(name string, ip string, data MemberData) {
+	data.Patroni.Scope = "acid-test"
+	c.pods = append(c.pods, newMockNamedPod(name, ip))
+	c.members[name] = data
+}
+
+func (c *fakeCluster) pod(name string) *v1.Pod {
+	for _, pod := range c.pods {
+		if pod.Name == name {
+			return pod
+		}
+	}
+	return nil
+}
+
+func (c *fakeCluster) client() *stubHTTPClient {
+	return &stubHTTPClient{handler: c.handle}
+}
+
+func (c *fakeCluster) handle(request *http.Request) (*http.Response, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	var name string
+	for _, pod := range c.pods {
+		if strings.HasPrefix(request.URL.Host, pod.Status.PodIP+":") {
+			name = pod.Name
+		}
+	}
+	data, ok := c.members[name]
+	if !ok {
+		return nil, fmt.Errorf("dial tcp %s: connection refused", request.URL.Host)
+	}
+
+	if request.Method == http.MethodGet && request.URL.Path == clusterPath {
+		var cluster clusterStatus
+		for _, pod := range c.pods {
+			member := c.members[pod.Name]
+			role := member.Role
+			if member.IsLeader() {
+				role = "leader"
+			}
+			cluster.Members = append(cluster.Members, ClusterMember{Name: pod.Name, Role: role, State: member.State, Timeline: member.Timeline})
+		}
+		body, err := json.Marshal(cluster)
+		if err != nil {
+			return nil, err
+		}
+		return newMockResponse(http.StatusOK, string(body)), nil
+	}
+	if request.Method == http.MethodGet {
+		body, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return newMockResponse(http.StatusOK, string(body)), nil
+	}
+
+	c.posts = append(c.posts, name+request.URL.Path)
+	if c.rejectPosts || c.failPosts[name] {
+		return newMockResponse(http.StatusServiceUnavailable, "operation failed"), nil
+	}
+
+	switch request.URL.Path {
+	case restartPath:
+		// the restarted member catches up with the leader right away
+		for _, leader := range c.members {
+			if leader.IsLeader() && !data.IsLeader() {
+				data.Xlog.ReplayedLocation = leader.Xlog.Location
+			}
+		}
+		c.members[name] = data
+		return newMockResponse(http.StatusOK, "restarted successfully"), nil
+	}
+
+	var body map[string]string
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if c.promote {
+		leader, candidate := c.members[body["leader"]], c.members[body["member"]]
+		leader.Role, candidate.Role = "replica", "master"
+		leader.Xlog.ReplayedLocation, candidate.Xlog.Location = leader.Xlog.Location, candidate.Xlog.ReplayedLocation
+		c.members[body["leader"]], c.members[body["member"]] = leader, candidate
+	}
+	return newMockResponse(http.StatusOK, "Successfully switched over"), nil
+}
+
+func TestSafeSwitchover(t *testing.T) {
+	fastOptions := SwitchoverOptions{Timeout: 50 * time.Millisecond, PollInterval: time.Millisecond}
+
+	var testTable = []struct {
+		subtest       string
+		prepare       func(*fakeCluster)
+		options       SwitchoverOptions
+		expected      string
+		expectedError error
+		expectedPosts int
+		nilLogger     bool
+	}{
+		{
+			subtest:       "switchover to the most advanced replica",
+			options:       fastOptions,
+			expected:      "acid-test-2",
+			expectedPosts: 1,
+		},
+		{
+			subtest:       "switchover to an explicit candidate",
+			options:       SwitchoverOptions{Candidate: "acid-test-1", Timeout: time.Second, PollInterval: time.Millisecond},
+			expected:      "acid-test-1",
+			expectedPosts: 1,
+		},
+		{
+			subtest: "master is not the leader",
+			prepare: func(c *fakeCluster) {
+				c.members["acid-test-0"] = MemberData{State: "running", Role: "replica"}
+			},
+			options:       fastOptions,
+			expectedError: ErrNotLeader,
+		},
+		{
+			subtest: "no running replica",
+			prepare: func(c *fakeCluster) {
+				for _, name := range []string{"acid-test-1", "acid-test-2"} {
+					c.members[name] = MemberData{State: "starting", Role: "replica"}
+				}
+			},
+			options:       fastOptions,
+			expectedError: ErrNoCandidate,
+		},
+		{
+			subtest:       "candidate is not a member",
+			options:       SwitchoverOptions{Candidate: "acid-test-9", Timeout: time.Second},
+			expectedError: ErrNoCandidate,
+		},
+		{
+			subtest: "candidate on a diverged timeline",
+			prepare: func(c *fakeCluster) {
+				c.members["acid-test-0"] = MemberData{State: "running", Role: "master", Timeline: 7, Patroni: MemberDataPatroni{Scope: "acid-test"}}
+				c.members["acid-test-1"] = MemberData{State: "running", Role: "replica", Timeline: 6}
+			},
+			options:       SwitchoverOptions{Candidate: "acid-test-1", Timeout: time.Second},
+			expectedError: ErrNoCandidate,
+		},
+		{
+			subtest: "candidate on an unknown timeline",
+			prepare: func(c *fakeCluster) {
+				c.members["acid-test-1"] = MemberData{State: "running", Role: "replica"}
+			},
+			options:       SwitchoverOptions{Candidate: "acid-test-1", Timeout: time.Second, PollInterval: time.Millisecond},
+			expected:      "acid-test-1",
+			expectedPosts: 1,
+		},
+		{
+			subtest: "candidate on an unknown timeline without logger",
+			prepare: func(c *fakeCluster) {
+				c.members["acid-test-1"] = MemberData{State: "running", Role: "replica"}
+			},
+			options:       SwitchoverOptions{Candidate: "acid-test-1", Timeout: time.Second, PollInterval: time.Millisecond},
+			expected:      "acid-test-1",
+			expectedPosts: 1,
+			nilLogger:     true,
+		},
+		{
+			subtest:       "switchover rejected by Patroni",
+			prepare:       func(c *fakeCluster) { c.rejectPosts = true },
+			options:       fastOptions,
+			expectedPosts: 1,
+		},
+		{
+			subtest:       "no new leader within timeout",
+			prepare:       func(c *fakeCluster) { c.promote = false },
+			options:       fastOptions,
+			expectedPosts: 1,
+		},
+	}
+	for _, tt := range testTable {
+		cluster := newFakeCluster()
+		if tt.prepare != nil {
+			tt.prepare(cluster)
+		}
+		logger := testLogger
+		if tt.nilLogger {
+			logger = nil
+		}
+		p := New(logger, cluster.client())
+
+		leader, err := p.SafeSwitchover(context.Background(), cluster.pod("acid-test-0"), cluster.pods, tt.options)
+		if tt.expected != "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if tt.expected == "" && err == nil {
+			t.Errorf("%s: expected an error, got leader %q", tt.subtest, leader)
+		}
+		if tt.expectedError != nil && !errors.Is(err, tt.expectedError) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if leader != tt.expected {
+			t.Errorf("%s: expected new leader %q, got %q", tt.subtest, tt.expected, leader)
+		}
+		if len(cluster.posts) != tt.expectedPosts {
+			t.Errorf("%s: expected %d switchover requests, got %v", tt.subtest, tt.expectedPosts, cluster.posts)
+		}
+	}
+}
+
+func TestSafeSwitchoverCooldown(t *testing.T) {
+	cluster := newFakeCluster()
+	p := New(testLogger, cluster.client())
+	options := SwitchoverOptions{Cooldown: time.Hour, Timeout: time.Second, PollInterval: time.Millisecond}
+
+	leader, err := p.SafeSwitchover(context.Background(), cluster.pod("acid-test-0"), cluster.pods, options)
+	if err != nil {
+		t.Fatalf("unexpected error on first switchover: %v", err)
+	}
+
+	_, err = p.SafeSwitchover(context.Background(), cluster.pod(leader), cluster.pods, options)
+	if !errors.Is(err, ErrSwitchoverCooldown) {
+		t.Errorf("expected cooldown error on second switchover, got %v", err)
+	}
+	if len(cluster.posts) != 1 {
+		t.Errorf("expected a single switchover request, got %v", cluster.posts)
+	}
+}
+
+func TestSafeSwitchoverRetryAfterFailure(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.rejectPosts = true
+	p := New(testLogger, cluster.client())
+	options := SwitchoverOptions{Cooldown: time.Hour, Timeout: time.Second, PollInterval: time.Millisecond}
+
+	if _, err := p.SafeSwitchover(context.Background(), cluster.pod("acid-test-0"), cluster.pods, options); err == nil {
+		t.Fatal("expected the first switchover to fail")
+	}
+
+	cluster.rejectPosts = false
+	leader, err := p.SafeSwitchover(context.Background(), cluster.pod("acid-test-0"), cluster.pods, options)
+	if err != nil {
+		t.Fatalf("expected the retry within the cooldown to be allowed, got %v", err)
+	}
+	if leader != "acid-test-2" {
+		t.Errorf("expected acid-test-2 to be the new leader, got %q", leader)
+	}
+
+	_, err = p.SafeSwitchover(context.Background(), cluster.pod(leader), cluster.pods, options)
+	if !errors.Is(err, ErrSwitchoverCooldown) {
+		t.Errorf("expected cooldown error after the successful switchover, got %v", err)
+	}
+}
+
+func TestFailoverBody(t *testing.T) {
+	now := time.Date(2021, 2, 19, 14, 0, 0, 0, time.UTC)
+	master := newMockNamedPod("acid-test-0", "192.168.100.1")
+
+	var testTable = []struct {
+		subtest  string
+		call     func(p *Patroni) error
+		expected map[string]interface{}
+	}{
+		{
+			subtest: "immediate switchover",
+			call: func(p *Patroni) error {
+				return p.Switchover(context.Background(), master, "acid-test-1")
+			},
+			expected: map[string]interface{}{"leader": "acid-test-0", "member": "acid-test-1"},
+		},
+		{
+			subtest: "scheduled failover",
+			call: func(p *Patroni) error {
+				return p.ScheduledFailover(context.Background(), master, "acid-test-1", now.Add(time.Hour))
+			},
+			expected: map[string]interface{}{"leader": "acid-test-0", "member": "acid-test-1", "scheduled_at": "2021-02-19T15:00:00Z"},
+		},
+		{
+			subtest: "scheduled failover without time",
+			call: func(p *Patroni) error {
+				return p.ScheduledFailover(context.Background(), master, "acid-test-1", time.Time{})
+			},
+			expected: map[string]interface{}{"leader": "acid-test-0", "member": "acid-test-1"},
+		},
+		{
+			subtest: "leaderless failover",
+			call: func(p *Patroni) error {
+				return p.Failover(context.Background(), newMockNamedPod("acid-test-2", "192.168.100.3"), "acid-test-1")
+			},
+			expected: map[string]interface{}{"candidate": "acid-test-1"},
+		},
+		{
+			subtest: "switchover in citus group",
+			call: func(p *Patroni) error {
+				return p.SwitchoverGroup(context.Background(), master, "acid-test-1", 2)
+			},
+			expected: map[string]interface{}{"leader": "acid-test-0", "member": "acid-test-1", "group": float64(2)},
+		},
+		{
+			subtest: "failover in citus coordinator group",
+			call: func(p *Patroni) error {
+				return p.FailoverGroup(context.Background(), master, "acid-test-1", 0)
+			},
+			expected: map[string]interface{}{"candidate": "acid-test-1", "group": float64(0)},
+		},
+	}
+	for _, tt := range testTable {
+		var body map[string]interface{}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.URL.Path != failoverPath {
+				t.Errorf("%s: unexpected request to %s", tt.subtest, request.URL.Path)
+			}
+			return newMockResponse(http.StatusOK, "ok"), json.NewDecoder(request.Body).Decode(&body)
+		}}
+		p := New(nil, client, WithClock(&fakeClock{now: now}))
+
+		if err := tt.call(p); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if !reflect.DeepEqual(body, tt.expected) {
+			t.Errorf("%s: expected body %v, got %v", tt.subtest, tt.expected, body)
+		}
+	}
+}
+
+func TestScheduledFailoverInThePast(t *testing.T) {
+	now := time.Date(2021, 2, 19, 14, 0, 0, 0, time.UTC)
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request to %s", request.URL.Path)
+		return newMockResponse(http.StatusOK, "ok"), nil
+	}}
+	p := New(nil, client, WithClock(&fakeClock{now: now}))
+
+	if err := p.ScheduledFailover(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), "acid-test-1", now.Add(-time.Minute)); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("expected %v for a scheduled time in the past, got %v", ErrInvalidSchedule, err)
+	}
+}
+
+func TestScheduledFailoverRejected(t *testing.T) {
+	now := time.Date(2021, 2, 19, 14, 0, 0, 0, time.UTC)
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusUnprocessableEntity, "Can't schedule switchover in the past"), nil
+	}}
+	// the local clock is behind the one of Patroni
+	p := New(nil, client, WithClock(&fakeClock{now: now}))
+
+	err := p.ScheduledFailover(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), "acid-test-1", now.Add(time.Second))
+	if !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("expected %v, got %v", ErrInvalidSchedule, err)
+	}
+}
+
+func TestSwitchoverInWindow(t *testing.T) {
+	date := time.Date(2021, 2, 19, 0, 0, 0, 0, time.UTC)
+	var testTable = []struct {
+		subtest       string
+		now           time.Time
+		window        TimeWindow
+		expectedError error
+	}{
+		{
+			subtest: "within window",
+			now:     date.Add(3 * time.Hour),
+			window:  TimeWindow{Start: 2 * time.Hour, End: 4 * time.Hour},
+		},
+		{
+			subtest:       "before window",
+			now:           date.Add(time.Hour),
+			window:        TimeWindow{Start: 2 * time.Hour, End: 4 * time.Hour},
+			expectedError: ErrOutsideWindow,
+		},
+		{
+			subtest:       "at end of window",
+			now:           date.Add(4 * time.Hour),
+			window:        TimeWindow{Start: 2 * time.Hour, End: 4 * time.Hour},
+			expectedError: ErrOutsideWindow,
+		},
+		{
+			subtest: "spanning midnight before midnight",
+			now:     date.Add(23 * time.Hour),
+			window:  TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour},
+		},
+		{
+			subtest: "spanning midnight after midnight",
+			now:     date.Add(time.Hour),
+			window:  TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour},
+		},
+		{
+			subtest:       "outside window spanning midnight",
+			now:           date.Add(12 * time.Hour),
+			window:        TimeWindow{Start: 22 * time.Hour, End: 2 * time.Hour},
+			expectedError: ErrOutsideWindow,
+		},
+		{
+			subtest: "window in another location",
+			now:     date.Add(12 * time.Hour),
+			window:  TimeWindow{Start: 0, End: 2 * time.Hour, Location: time.FixedZone("UTC+13", 13*60*60)},
+		},
+	}
+	for _, tt := range testTable {
+		requests := 0
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			requests++
+			return newMockResponse(http.StatusOK, "ok"), nil
+		}}
+		p := New(nil, client, WithClock(&fakeClock{now: tt.now}))
+
+		err := p.SwitchoverInWindow(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), "acid-test-1", tt.window)
+		if !errors.Is(err, tt.expectedError) || (tt.expectedError == nil && err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if tt.expectedError != nil && requests != 0 {
+			t.Errorf("%s: expected no switchover request, got %d", tt.subtest, requests)
+		}
+	}
+}
+
+func TestSwitchoverWithOutcome(t *testing.T) {
+	options := SwitchoverOptions{Timeout: 50 * time.Millisecond, PollInterval: time.Millisecond}
+
+	var testTable = []struct {
+		subtest  string
+		prepare  func(*fakeCluster)
+		expected SwitchoverOutcome
+	}{
+		{
+			subtest:  "promoted",
+			expected: SwitchoverPromoted,
+		},
+		{
+			subtest: "no candidate",
+			prepare: func(c *fakeCluster) {
+				delete(c.members, "acid-test-1")
+				delete(c.members, "acid-test-2")
+			},
+			expected: SwitchoverNoCandidate,
+		},
+		{
+			subtest:  "rejected",
+			prepare:  func(c *fakeCluster) { c.rejectPosts = true },
+			expected: SwitchoverRejected,
+		},
+		{
+			subtest:  "timeout",
+			prepare:  func(c *fakeCluster) { c.promote = false },
+			expected: SwitchoverTimeout,
+		},
+	}
+	for _, tt := range testTable {
+		cluster := newFakeCluster()
+		if tt.prepare != nil {
+			tt.prepare(cluster)
+		}
+		p := New(testLogger, cluster.client())
+
+		_, outcome, err := p.SwitchoverWithOutcome(context.Background(), cluster.pod("acid-test-0"), cluster.pods, options)
+		if outcome != tt.expected {
+			t.Errorf("%s: expected outcome %s, got %s (error %v)", tt.subtest, tt.expected, outcome, err)
+		}
+		if (err == nil) != (tt.expected == SwitchoverPromoted) {
+			t.Errorf("%s: unexpected error %v", tt.subtest, err)
+		}
+	}
+}
+
+func TestSwitchoverWithDrain(t *testing.T) {
+	var testTable = []struct {
+		subtest         string
+		config          string
+		failSwitchover  bool
+		expectedRestore interface{}
+		expectedError   bool
+	}{
+		{
+			subtest:         "switchover succeeds",
+			config:          `{"postgresql": {"parameters": {"max_connections": 100}}}`,
+			expectedRestore: nil,
+		},
+		{
+			subtest:         "switchover fails",
+			config:          `{"postgresql": {"parameters": {"default_transaction_read_only": "off"}}}`,
+			failSwitchover:  true,
+			expectedRestore: "off",
+			expectedError:   true,
+		},
+	}
+	for _, tt := range testTable {
+		var steps []string
+		var patches []map[string]interface{}
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodGet {
+				return newMockResponse(http.StatusOK, tt.config), nil
+			}
+			steps = append(steps, request.Method+" "+request.URL.Path)
+			if request.Method == http.MethodPatch {
+				var patch map[string]interface{}
+				body, _ := ioutil.ReadAll(request.Body)
+				if err := json.Unmarshal(body, &patch); err != nil {
+					t.Fatalf("%s: could not decode patch: %v", tt.subtest, err)
+				}
+				patches = append(patches, patch)
+			}
+			if request.URL.Path == failoverPath && tt.failSwitchover {
+				return newMockResponse(http.StatusPreconditionFailed, "candidate not healthy"), nil
+			}
+			return newMockResponse(http.StatusOK, "{}"), nil
+		}}
+		p := New(testLogger, client)
+
+		err := p.SwitchoverWithDrain(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"), "acid-test-1", time.Millisecond)
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+
+		expectedSteps := []string{"PATCH /config", "POST /failover", "PATCH /config"}
+		if !reflect.DeepEqual(steps, expectedSteps) {
+			t.Fatalf("%s: expected steps %v, got %v", tt.subtest, expectedSteps, steps)
+		}
+		drained, _ := lookupConfig(patches[0], "postgresql", "parameters", readOnlyParameter)
+		if drained != "on" {
+			t.Errorf("%s: expected read-only to be enabled first, got %v", tt.subtest, patches[0])
+		}
+		parameters, _ := lookupConfig(patches[1], "postgresql", "parameters")
+		restored, ok := parameters.(map[string]interface{})[readOnlyParameter]
+		if !ok || restored != tt.expectedRestore {
+			t.Errorf("%s: expected read-only to be restored to %v, got %v", tt.subtest, tt.expectedRestore, patches[1])
+		}
+	}
+}
+
+func TestTimelinesMatch(t *testing.T) {
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running", "timeline": 7},
+		{"name": "acid-test-1", "role": "replica", "state": "streaming", "timeline": 7},
+		{"name": "acid-test-2", "role": "replica", "state": "running", "timeline": 6},
+		{"name": "acid-test-3", "role": "replica", "state": "stopped"}
+	]}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		if request.URL.Path == clusterPath {
+			return newMockResponse(http.StatusOK, cluster), nil
+		}
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master", "timeline": 7}`), nil
+	}}
+	p := New(testLogger, client)
+	master := newMockNamedPod("acid-test-0", "192.168.100.1")
+
+	var testTable = []struct {
+		candidate     string
+		expected      bool
+		expectedError bool
+	}{
+		{candidate: "acid-test-1", expected: true},
+		{candidate: "acid-test-2", expected: false},
+		{candidate: "acid-test-3", expectedError: true},
+		{candidate: "acid-test-9", expectedError: true},
+	}
+	for _, tt := range testTable {
+		match, err := p.TimelinesMatch(context.Background(), master, tt.candidate)
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.candidate, tt.expectedError, err)
+		}
+		if match != tt.expected {
+			t.Errorf("%s: expected match %v, got %v", tt.candidate, tt.expected, match)
+		}
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	const mib = 1 << 20
+	replica := func(replayed int64, timeline int, sync bool, tags map[string]interface{}) MemberData {
+		return MemberData{State: "running", Role: "replica", Timeline: timeline, SyncStandby: sync, Tags: tags, Xlog: MemberDataXlog{ReplayedLocation: replayed}}
+	}
+	members := map[string]MemberData{
+		"acid-test-0": {State: "running", Role: "master", Timeline: 6, Xlog: MemberDataXlog{Location: 100 * mib}},
+		"acid-test-1": replica(100*mib, 6, false, nil),
+		"acid-test-2": replica(98*mib, 6, true, nil),
+		"acid-test-3": replica(100*mib, 5, true, nil),
+		"acid-test-4": replica(100*mib, 6, true, map[string]interface{}{"nofailover": true}),
+		"acid-test-5": {State: "stopped", Role: "replica", Timeline: 6},
+		"acid-test-6": replica(100*mib, 6, false, map[string]interface{}{"failover_priority": 3}),
+	}
+
+	ranked, err := RankCandidates(newMockNamedPod("acid-test-0", "192.168.100.1"), members)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []RankedCandidate{
+		{Name: "acid-test-2", Score: 89, Factors: RankingFactors{LagBytes: 2 * mib, SyncStandby: true, TimelineMatch: true, FailoverPriority: 1}},
+		{Name: "acid-test-6", Score: 73, Factors: RankingFactors{TimelineMatch: true, FailoverPriority: 3}},
+		{Name: "acid-test-1", Score: 71, Factors: RankingFactors{TimelineMatch: true, FailoverPriority: 1}},
+		{Name: "acid-test-3", Score: 51, Factors: RankingFactors{SyncStandby: true, FailoverPriority: 1}},
+	}
+	if !reflect.DeepEqual(ranked, expected) {
+		t.Errorf("expected ranking %+v, got %+v", expected, ranked)
+	}
+
+	delete(members, "acid-test-0")
+	if _, err := RankCandidates(newMockNamedPod("acid-test-0", "192.168.100.1"), members); err == nil {
+		t.Errorf("expected an error without member data of the master")
+	}
+	members = map[string]MemberData{"acid-test-0": {State: "running", Role: "master"}}
+	if _, err := RankCandidates(newMockNamedPod("acid-test-0", "192.168.100.1"), members); !errors.Is(err, ErrNoCandidate) {
+		t.Errorf("expected %v, got %v", ErrNoCandidate, err)
+	}
+}
+
+func TestWaitForNewLeader(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		leader        string
+		expected      string
+		expectedError error
+	}{
+		{
+			subtest:  "new leader elected",
+			leader:   "acid-test-2",
+			expected: "acid-test-2",
+		},
+		{
+			subtest:       "previous leader keeps the lock",
+			leader:        "acid-test-0",
+			expectedError: ErrNoNewLeader,
+		},
+	}
+	for _, tt := range testTable {
+		cluster := newFakeCluster()
+		for name, data := range cluster.members {
+			data.Role = "replica"
+			if name == tt.leader {
+				data.Role = "master"
+			}
+			cluster.members[name] = data
+		}
+		clock := &fakeClock{now: time.Date(2021, 2, 19, 14, 0, 0, 0, time.UTC), step: time.Minute}
+		p := New(testLogger, cluster.client(), WithClock(clock), WithPollInterval(0))
+
+		leader, err := p.WaitForNewLeader(context.Background(), cluster.pods, "acid-test-0", time.Hour)
+		if !errors.Is(err, tt.expectedError) || (tt.expectedError == nil && err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if leader != tt.expected {
+			t.Errorf("%s: expected leader %q, got %q", tt.subtest, tt.expected, leader)
+		}
+	}
+}
+
+func TestGetMembersDataLag(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.add("acid-test-3", "10.0.0.4", MemberData{State: "starting", Role: "replica"})
+	p := New(testLogger, cluster.client())
+
+	members, errs := p.GetMembersData(context.Background(), cluster.pods)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	lags := make(map[string]int64)
+	for name, data := range members {
+		if data.Lag != nil {
+			lags[name] = *data.Lag
+		}
+	}
+	if expected := map[string]int64{"acid-test-1": 100, "acid-test-2": 0}; !reflect.DeepEqual(lags, expected) {
+		t.Errorf("expected lags %v, got %v", expected, lags)
+	}
+
+	// without the leader the lag is unknown
+	members, _ = p.GetMembersData(context.Background(), cluster.pods[1:])
+	for name, data := range members {
+		if data.Lag != nil {
+			t.Errorf("expected no lag for %s without the leader, got %d", name, *data.Lag)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ErrNoSyncStandby is returned when no member acts as synchronous standby,
+// either because synchronous mode is off or no replica qualifies for it
+var ErrNoSyncStandby = errors.New("no synchronous standby")
+
+// GetSyncStandbyPod returns the pod of the member currently acting as the
+// synchronous standby. With several synchronous standbys the one with the
+// lowest member name is returned.
+func GetSyncStandbyPod(members map[string]MemberData, pods []*v1.Pod) (*v1.Pod, error) {
+	var names []string
+	for name, data := range members {
+		if data.SyncStandby {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, ErrNoSyncStandby
+	}
+	sort.Strings(names)
+
+	for _, pod := range pods {
+		if pod.Name == names[0] {
+			return pod, nil
+		}
+	}
+	return nil, fmt.Errorf("no pod found for synchronous standby %s", names[0])
+}
+
+// IsSyncStandbyNamed tells whether the member is listed in the leader's
+// synchronous_standby_names, which Patroni reports as sync_standby
+func (m MemberData) IsSyncStandbyNamed() bool {
+	return m.SyncStandby
+}
+
+// GetSynchronousStandbyNames returns the names of the standbys the leader
+// currently counts for synchronous replication, those in sync, quorum or
+// potential state in its pg_stat_replication, by priority. In synchronous
+// mode Patroni sets synchronous_standby_names itself and ignores the value
+// in the dynamic configuration, so it is not read. Listed standbys which are
+// not connected are left out. Other members than the leader are reported
+// with a NotLeaderError.
+func (p *Patroni) GetSynchronousStandbyNames(ctx context.Context, server *v1.Pod) ([]string, error) {
+	if err := p.verifyLeader(ctx, server); err != nil {
+		return nil, err
+	}
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	var standbys []MemberDataReplication
+	for _, replication := range data.Replication {
+		switch replication.SyncState {
+		case "sync", "quorum", "potential":
+			standbys = append(standbys, replication)
+		}
+	}
+	sort.SliceStable(standbys, func(i, j int) bool {
+		if standbys[i].SyncPriority != standbys[j].SyncPriority {
+			return standbys[i].SyncPriority < standbys[j].SyncPriority
+		}
+		return standbys[i].ApplicationName < standbys[j].ApplicationName
+	})
+	names := make([]string, 0, len(standbys))
+	for _, standby := range standbys {
+		names = append(names, standby.ApplicationName)
+	}
+	return names, nil
+}
+
+// SynchronousModeActive tells whether synchronous replication is in effect
+// from the member's point of view: a leader needs at least one standby in
+// sync or quorum state, a replica has to be a synchronous standby itself.
+// It can be false while synchronous_mode is configured, e.g. when there are
+// not enough healthy standbys.
+func (m MemberData) SynchronousModeActive() bool {
+	if !m.IsLeader() {
+		return m.SyncStandby
+	}
+	for _, replication := range m.Replication {
+		if replication.SyncState == "sync" || replication.SyncState == "quorum" {
+			return true
+		}
+	}
+	return false
+}
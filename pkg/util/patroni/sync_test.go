@@ -0,0 +1,145 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetSyncStandbyPod(t *testing.T) {
+	pods := []*v1.Pod{
+		newMockNamedPod("acid-test-0", "10.0.0.1"),
+		newMockNamedPod("acid-test-1", "10.0.0.2"),
+		newMockNamedPod("acid-test-2", "10.0.0.3"),
+	}
+
+	var testTable = []struct {
+		subtest       string
+		members       map[string]MemberData
+		expected      string
+		expectedError error
+	}{
+		{
+			subtest: "sync standby present",
+			members: map[string]MemberData{
+				"acid-test-0": {Role: "master"},
+				"acid-test-1": {Role: "replica"},
+				"acid-test-2": {Role: "replica", SyncStandby: true},
+			},
+			expected: "acid-test-2",
+		},
+		{
+			subtest: "several sync standbys",
+			members: map[string]MemberData{
+				"acid-test-0": {Role: "master"},
+				"acid-test-1": {Role: "replica", SyncStandby: true},
+				"acid-test-2": {Role: "replica", SyncStandby: true},
+			},
+			expected: "acid-test-1",
+		},
+		{
+			subtest: "sync standby absent",
+			members: map[string]MemberData{
+				"acid-test-0": {Role: "master"},
+				"acid-test-1": {Role: "replica"},
+			},
+			expectedError: ErrNoSyncStandby,
+		},
+	}
+	for _, tt := range testTable {
+		pod, err := GetSyncStandbyPod(tt.members, pods)
+		if tt.expectedError != nil {
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("%s: expected error %v, got %v", tt.subtest, tt.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+			continue
+		}
+		if pod.Name != tt.expected {
+			t.Errorf("%s: expected sync standby %s, got %s", tt.subtest, tt.expected, pod.Name)
+		}
+	}
+}
+
+func TestGetSynchronousStandbyNames(t *testing.T) {
+	cluster := `{"members": [{"name": "acid-test-0", "role": "leader", "state": "running"}, {"name": "acid-test-1", "role": "replica", "state": "running"}]}`
+	leader := `{"state": "running", "role": "master", "replication": [
+		{"application_name": "acid-test-3", "state": "streaming", "sync_state": "async", "sync_priority": 0},
+		{"application_name": "acid-test-2", "state": "streaming", "sync_state": "potential", "sync_priority": 2},
+		{"application_name": "acid-test-1", "state": "streaming", "sync_state": "sync", "sync_priority": 1}
+	]}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		switch {
+		case request.URL.Path == clusterPath:
+			return newMockResponse(http.StatusOK, cluster), nil
+		case request.URL.Hostname() == "192.168.100.1":
+			return newMockResponse(http.StatusOK, leader), nil
+		}
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "replica", "sync_standby": true}`), nil
+	}}
+	p := New(testLogger, client)
+
+	names, err := p.GetSynchronousStandbyNames(context.Background(), newMockNamedPod("acid-test-0", "192.168.100.1"))
+	if err != nil {
+		t.Fatalf("could not get synchronous standby names: %v", err)
+	}
+	expected := []string{"acid-test-1", "acid-test-2"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	_, err = p.GetSynchronousStandbyNames(context.Background(), newMockNamedPod("acid-test-1", "192.168.100.2"))
+	if !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected ErrNotLeader for a replica, got %v", err)
+	}
+
+	if !(MemberData{Role: "replica", SyncStandby: true}).IsSyncStandbyNamed() {
+		t.Errorf("expected member reporting sync_standby to be named")
+	}
+}
+
+func TestSynchronousModeActive(t *testing.T) {
+	var testTable = []struct {
+		subtest  string
+		payload  string
+		expected bool
+	}{
+		{
+			subtest:  "leader with synchronous standby",
+			payload:  `{"state": "running", "role": "master", "replication": [{"usename": "standby", "application_name": "acid-test-1", "client_addr": "10.0.0.2", "state": "streaming", "sync_state": "sync", "sync_priority": 1}]}`,
+			expected: true,
+		},
+		{
+			subtest:  "leader with asynchronous standby only",
+			payload:  `{"state": "running", "role": "master", "replication": [{"usename": "standby", "application_name": "acid-test-1", "client_addr": "10.0.0.2", "state": "streaming", "sync_state": "async", "sync_priority": 0}]}`,
+			expected: false,
+		},
+		{
+			subtest:  "synchronous standby",
+			payload:  `{"state": "running", "role": "replica", "sync_standby": true}`,
+			expected: true,
+		},
+		{
+			subtest:  "asynchronous replica",
+			payload:  `{"state": "running", "role": "replica"}`,
+			expected: false,
+		},
+	}
+	for _, tt := range testTable {
+		var data MemberData
+		if err := json.Unmarshal([]byte(tt.payload), &data); err != nil {
+			t.Fatalf("%s: could not parse payload: %v", tt.subtest, err)
+		}
+		if active := data.SynchronousModeActive(); active != tt.expected {
+			t.Errorf("%s: expected synchronous mode active %t, got %t", tt.subtest, tt.expected, active)
+		}
+	}
+}
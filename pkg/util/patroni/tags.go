@@ -0,0 +1,108 @@
+package patroni
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// GetMemberTags returns the tags the member reports, empty if it has none
+func (p *Patroni) GetMemberTags(ctx context.Context, server *v1.Pod) (map[string]interface{}, error) {
+	data, err := p.GetMemberData(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	if data.Tags == nil {
+		return map[string]interface{}{}, nil
+	}
+	return data.Tags, nil
+}
+
+// SetNoSync would set the nosync tag of the member, which excludes it from
+// becoming a synchronous standby. Patroni reads tags only from the local
+// configuration of each member, a tag in the dynamic configuration would be
+// ignored, so it always returns ErrNotSupported without sending anything.
+// The tag has to be set in the local configuration of the pod, e.g. through
+// its environment, and can be read back with GetMemberTags.
+func (p *Patroni) SetNoSync(ctx context.Context, server *v1.Pod, noSync bool) error {
+	return fmt.Errorf("could not set the nosync tag of %s: %w", server.Name, ErrNotSupported)
+}
+
+// MemberFailoverFlags are the tags of a member which affect failover
+type MemberFailoverFlags struct {
+	NoFailover    bool
+	NoSync        bool
+	CloneFrom     bool
+	ReplicateFrom string
+}
+
+// tagEnabled interprets a boolean tag, which Patroni also accepts as string
+func tagEnabled(tags map[string]interface{}, name string) bool {
+	switch value := tags[name].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true") || strings.EqualFold(value, "on")
+	}
+	return false
+}
+
+// FailoverTagReport returns the failover related tags of all members, keyed
+// by member name
+func (p *Patroni) FailoverTagReport(ctx context.Context, server *v1.Pod) (map[string]MemberFailoverFlags, error) {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	report := make(map[string]MemberFailoverFlags, len(cluster.Members))
+	for _, member := range cluster.Members {
+		flags := MemberFailoverFlags{
+			NoFailover: tagEnabled(member.Tags, "nofailover"),
+			NoSync:     tagEnabled(member.Tags, "nosync"),
+			CloneFrom:  tagEnabled(member.Tags, "clonefrom"),
+		}
+		if replicateFrom, ok := member.Tags["replicatefrom"]; ok {
+			flags.ReplicateFrom = fmt.Sprintf("%v", replicateFrom)
+		}
+		report[member.Name] = flags
+	}
+	return report, nil
+}
+
+// defaultFailoverPriority is Patroni's priority of members without the tag
+const defaultFailoverPriority = 1
+
+// failoverPriority reads the failover_priority tag. Members with nofailover
+// get priority 0, which means they are never promoted.
+func failoverPriority(tags map[string]interface{}) int {
+	if tagEnabled(tags, "nofailover") {
+		return 0
+	}
+	value, ok := tags["failover_priority"]
+	if !ok {
+		return defaultFailoverPriority
+	}
+	priority, err := strconv.Atoi(fmt.Sprintf("%v", value))
+	if err != nil {
+		return defaultFailoverPriority
+	}
+	return priority
+}
+
+// GetFailoverPriorities returns the failover priority of every member, keyed
+// by member name. Higher values are preferred, 0 means never promote.
+func (p *Patroni) GetFailoverPriorities(ctx context.Context, server *v1.Pod) (map[string]int, error) {
+	cluster, err := p.getCluster(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	priorities := make(map[string]int, len(cluster.Members))
+	for _, member := range cluster.Members {
+		priorities[member.Name] = failoverPriority(member.Tags)
+	}
+	return priorities, nil
+}
@@ -0,0 +1,103 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSetNoSync(t *testing.T) {
+	for _, noSync := range []bool{true, false} {
+		var requests int
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			requests++
+			return newMockResponse(http.StatusOK, "{}"), nil
+		}}
+		p := New(nil, client)
+
+		err := p.SetNoSync(context.Background(), newMockPod("192.168.100.1"), noSync)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+		if requests != 0 {
+			t.Errorf("expected no request, got %d", requests)
+		}
+	}
+}
+
+func TestGetMemberTags(t *testing.T) {
+	status := `{"state": "running", "role": "replica", "tags": {"nosync": true, "clonefrom": true}}`
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, status), nil
+	}}
+	p := New(nil, client)
+
+	tags, err := p.GetMemberTags(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[string]interface{}{"nosync": true, "clonefrom": true}; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, tags)
+	}
+}
+
+func TestFailoverTagReport(t *testing.T) {
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running"},
+		{"name": "acid-test-1", "role": "replica", "state": "running", "tags": {"nofailover": true, "nosync": "true"}},
+		{"name": "acid-test-2", "role": "replica", "state": "running", "tags": {"clonefrom": true, "replicatefrom": "acid-test-1"}}
+	]}`
+	p := New(testLogger, newClusterClient(cluster))
+
+	report, err := p.FailoverTagReport(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]MemberFailoverFlags{
+		"acid-test-0": {},
+		"acid-test-1": {NoFailover: true, NoSync: true},
+		"acid-test-2": {CloneFrom: true, ReplicateFrom: "acid-test-1"},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %#v, got %#v", expected, report)
+	}
+}
+
+func TestGetFailoverPriorities(t *testing.T) {
+	cluster := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running"},
+		{"name": "acid-test-1", "role": "replica", "state": "running", "tags": {"failover_priority": 5}},
+		{"name": "acid-test-2", "role": "replica", "state": "running", "tags": {"failover_priority": "0"}},
+		{"name": "acid-test-3", "role": "replica", "state": "running", "tags": {"nofailover": true}}
+	]}`
+	p := New(testLogger, newClusterClient(cluster))
+
+	priorities, err := p.GetFailoverPriorities(context.Background(), newMockPod("192.168.100.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]int{"acid-test-0": 1, "acid-test-1": 5, "acid-test-2": 0, "acid-test-3": 0}
+	if !reflect.DeepEqual(priorities, expected) {
+		t.Errorf("expected %v, got %v", expected, priorities)
+	}
+}
+
+func TestChooseSwitchoverCandidateByPriority(t *testing.T) {
+	master := newMockNamedPod("acid-test-0", "10.0.0.1")
+	members := map[string]MemberData{
+		"acid-test-0": {Role: "master", State: "running"},
+		"acid-test-1": {Role: "replica", State: "running", Xlog: MemberDataXlog{ReplayedLocation: 300}},
+		"acid-test-2": {Role: "replica", State: "running", Xlog: MemberDataXlog{ReplayedLocation: 300}, Tags: map[string]interface{}{"failover_priority": float64(3)}},
+		"acid-test-3": {Role: "replica", State: "running", Xlog: MemberDataXlog{ReplayedLocation: 400}, Tags: map[string]interface{}{"failover_priority": float64(0)}},
+	}
+
+	candidate, err := ChooseSwitchoverCandidate(master, members)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if candidate != "acid-test-2" {
+		t.Errorf("expected the higher priority replica acid-test-2, got %s", candidate)
+	}
+}
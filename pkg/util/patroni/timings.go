@@ -0,0 +1,62 @@
+package patroni
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Patroni's defaults of the HA timing parameters
+const (
+	defaultTTL          = 30 * time.Second
+	defaultLoopWait     = 10 * time.Second
+	defaultRetryTimeout = 10 * time.Second
+)
+
+// Timings are the HA timing parameters of a cluster
+type Timings struct {
+	TTL          time.Duration
+	LoopWait     time.Duration
+	RetryTimeout time.Duration
+}
+
+// Validate enforces Patroni's invariants, all timings have to be positive
+// and loop_wait + 2*retry_timeout must not exceed ttl
+func (t Timings) Validate() error {
+	if t.TTL <= 0 || t.LoopWait <= 0 || t.RetryTimeout <= 0 {
+		return fmt.Errorf("ttl %v, loop_wait %v and retry_timeout %v have to be positive", t.TTL, t.LoopWait, t.RetryTimeout)
+	}
+	if t.LoopWait+2*t.RetryTimeout > t.TTL {
+		return fmt.Errorf("loop_wait %v + 2*retry_timeout %v exceeds ttl %v", t.LoopWait, t.RetryTimeout, t.TTL)
+	}
+	return nil
+}
+
+// GetTimings reads ttl, loop_wait and retry_timeout at once, using Patroni's
+// defaults for those not set
+func (p *Patroni) GetTimings(ctx context.Context, server *v1.Pod) (Timings, error) {
+	config, err := p.GetConfig(ctx, server)
+	if err != nil {
+		return Timings{}, err
+	}
+
+	timings := Timings{
+		TTL:          defaultTTL,
+		LoopWait:     defaultLoopWait,
+		RetryTimeout: defaultRetryTimeout,
+	}
+	for key, timing := range map[string]*time.Duration{
+		"ttl":           &timings.TTL,
+		"loop_wait":     &timings.LoopWait,
+		"retry_timeout": &timings.RetryTimeout,
+	} {
+		if value, ok := config[key]; ok {
+			if *timing, err = configSeconds(value); err != nil {
+				return Timings{}, fmt.Errorf("could not parse %s: %v", key, err)
+			}
+		}
+	}
+	return timings, nil
+}
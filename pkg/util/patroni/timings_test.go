@@ -0,0 +1,52 @@
+package patroni
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetTimings(t *testing.T) {
+	var testTable = []struct {
+		subtest  string
+		config   string
+		expected Timings
+	}{
+		{
+			subtest:  "all timings set",
+			config:   `{"ttl": 60, "loop_wait": 15, "retry_timeout": 20}`,
+			expected: Timings{TTL: 60 * time.Second, LoopWait: 15 * time.Second, RetryTimeout: 20 * time.Second},
+		},
+		{
+			subtest:  "defaults",
+			config:   `{"ttl": 40}`,
+			expected: Timings{TTL: 40 * time.Second, LoopWait: 10 * time.Second, RetryTimeout: 10 * time.Second},
+		},
+	}
+	for _, tt := range testTable {
+		client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+			return newMockResponse(http.StatusOK, tt.config), nil
+		}}
+		p := New(testLogger, client)
+
+		timings, err := p.GetTimings(context.Background(), newMockPod("192.168.100.1"))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+		if timings != tt.expected {
+			t.Errorf("%s: expected %#v, got %#v", tt.subtest, tt.expected, timings)
+		}
+	}
+}
+
+func TestTimingsValidate(t *testing.T) {
+	good := Timings{TTL: 30 * time.Second, LoopWait: 10 * time.Second, RetryTimeout: 10 * time.Second}
+	if err := good.Validate(); err != nil {
+		t.Errorf("expected default timings to be valid, got %v", err)
+	}
+	bad := Timings{TTL: 20 * time.Second, LoopWait: 10 * time.Second, RetryTimeout: 10 * time.Second}
+	if err := bad.Validate(); err == nil {
+		t.Errorf("expected ttl below loop_wait + 2*retry_timeout to be invalid")
+	}
+}
@@ -0,0 +1,59 @@
+package patroni
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// NewTLSConfig creates a TLS config verifying the Patroni REST API against
+// the CA bundle in caFile, or the system roots if it is empty. If certFile
+// and keyFile are given, the client presents that certificate, as required
+// by Patroni's restapi.verify_client.
+func NewTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// normalizeFingerprint lowercases a hex SHA-256 fingerprint and removes the
+// colons some tools separate the bytes with
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// verifyPinnedCertificate rejects connections unless the server certificate
+// has the given normalized SHA-256 fingerprint
+func verifyPinnedCertificate(fingerprint string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		if actual := hex.EncodeToString(sum[:]); actual != fingerprint {
+			return fmt.Errorf("server certificate fingerprint %s does not match the pinned %s", actual, fingerprint)
+		}
+		return nil
+	}
+}
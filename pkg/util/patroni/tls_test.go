@@ -0,0 +1,183 @@
+package patroni
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acid-test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("could not write certificate: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("could not write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patroni-tls")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	config, err := NewTLSConfig(certFile, certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.RootCAs == nil || len(config.Certificates) != 1 {
+		t.Errorf("expected CA pool and client certificate, got %#v", config)
+	}
+
+	config, err = NewTLSConfig("", "", "")
+	if err != nil || config.RootCAs != nil || len(config.Certificates) != 0 {
+		t.Errorf("expected config using system roots, got %#v with error %v", config, err)
+	}
+
+	if _, err := NewTLSConfig(keyFile, "", ""); err == nil {
+		t.Error("expected error for CA bundle without certificates")
+	}
+	if _, err := NewTLSConfig("", certFile, filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("expected error for missing client key")
+	}
+}
+
+func TestHTTPS(t *testing.T) {
+	var urls []string
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		urls = append(urls, request.URL.String())
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+	}}
+	pod := newMockPod("192.168.100.1")
+
+	for _, options := range [][]Option{
+		{WithTLSConfig(&tls.Config{})},
+		{WithTLSConfig(nil)},
+		{WithInsecureSkipVerify()},
+	} {
+		urls = nil
+		p := New(testLogger, client, options...)
+		if _, err := p.GetMemberData(context.Background(), pod); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := p.GetConfig(context.Background(), pod); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := p.SetConfig(context.Background(), pod, map[string]interface{}{"ttl": 30}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(urls) != 3 {
+			t.Fatalf("expected 3 requests, got %v", urls)
+		}
+		for _, url := range urls {
+			if !strings.HasPrefix(url, "https://192.168.100.1:8008") {
+				t.Errorf("expected HTTPS request, got %s", url)
+			}
+		}
+	}
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	p := New(nil, nil, WithServerName("acid-test-0.acid-test.default.svc"), WithTLSConfig(config), WithInsecureSkipVerify())
+
+	transport := p.httpClient.(*http.Client).Transport.(*http.Transport)
+	tlsConfig := transport.TLSClientConfig
+	if tlsConfig.MinVersion != tls.VersionTLS12 || !tlsConfig.InsecureSkipVerify || tlsConfig.ServerName != "acid-test-0.acid-test.default.svc" {
+		t.Errorf("expected combined TLS config, got %#v", tlsConfig)
+	}
+	if config.InsecureSkipVerify || config.ServerName != "" {
+		t.Errorf("expected given TLS config to be left unchanged, got %#v", config)
+	}
+}
+
+func TestWithPinnedServerCert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ttl": 30}`))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("could not parse server URL: %v", err)
+	}
+	port, err := strconv.Atoi(serverURL.Port())
+	if err != nil {
+		t.Fatalf("could not parse server port: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	var testTable = []struct {
+		subtest       string
+		fingerprint   string
+		expectedError bool
+	}{
+		{
+			subtest:     "matching fingerprint",
+			fingerprint: fingerprint,
+		},
+		{
+			subtest:     "matching fingerprint with colons",
+			fingerprint: strings.ToUpper(fingerprint[:2] + ":" + fingerprint[2:4] + ":" + fingerprint[4:]),
+		},
+		{
+			subtest:       "other fingerprint",
+			fingerprint:   strings.Repeat("ab", sha256.Size),
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		p := New(testLogger, nil, WithTLSConfig(&tls.Config{RootCAs: pool}), WithPinnedServerCert(tt.fingerprint), WithPort(port))
+
+		_, err := p.GetConfig(context.Background(), newMockPod("127.0.0.1"))
+		if tt.expectedError != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package patroni
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redactedValue = "<redacted>"
+
+// defaultRedactedKeys are never written to the log in clear text
+var defaultRedactedKeys = []string{"password", "authentication"}
+
+// traceBody logs the body of a request or response, if explicitly enabled
+func (p *Patroni) traceBody(kind string, method string, url string, body []byte) {
+	if !p.traceBodies || p.logger == nil || !p.logger.Logger.IsLevelEnabled(logrus.TraceLevel) {
+		return
+	}
+	p.logger.Tracef("%s body of %s %s: %s", kind, method, url, p.truncate(p.redact(body)))
+}
+
+// truncate shortens a logged body to the configured maximum size
+func (p *Patroni) truncate(body string) string {
+	if p.maxLoggedBodySize <= 0 || len(body) <= p.maxLoggedBodySize {
+		return body
+	}
+	return body[:p.maxLoggedBodySize] + "..."
+}
+
+// redact masks the values of all redacted keys in a JSON body, bodies that
+// are not JSON are returned unchanged
+func (p *Patroni) redact(body []byte) string {
+	var parsed interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return string(body)
+	}
+	result, err := json.Marshal(p.redactValue(parsed))
+	if err != nil {
+		return string(body)
+	}
+	return string(result)
+}
+
+func (p *Patroni) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if p.isRedacted(key) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = p.redactValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = p.redactValue(item)
+		}
+	}
+	return value
+}
+
+func (p *Patroni) isRedacted(key string) bool {
+	for _, redacted := range p.redactedKeys {
+		if strings.EqualFold(key, redacted) {
+			return true
+		}
+	}
+	return false
+}
+
+// TraceEntry describes a single call of the Patroni API
+type TraceEntry struct {
+	Time      time.Time
+	Operation string
+	// Host is the host and port of the API the request was sent to
+	Host     string
+	Duration time.Duration
+	// Status is the HTTP status code, 0 if there was no response
+	Status int
+	Error  string
+}
+
+// recordOperation adds a call to the trace buffer and the API metrics, if
+// the client keeps them
+func (p *Patroni) recordOperation(start time.Time, method string, rawURL string, status int, err error) {
+	if p.metrics != nil {
+		p.metrics.observe(rawURL, status, time.Since(start))
+	}
+	if p.operations == nil {
+		return
+	}
+	entry := TraceEntry{
+		Time:      start,
+		Operation: method,
+		Host:      rawURL,
+		Duration:  time.Since(start),
+		Status:    status,
+	}
+	if parsed, parseErr := url.Parse(rawURL); parseErr == nil {
+		entry.Operation = method + " " + parsed.Path
+		entry.Host = parsed.Host
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	p.operations.Insert(entry)
+}
+
+// RecentOperations returns the operations kept in the trace buffer, oldest
+// first. It is empty unless the client was created WithTraceBuffer.
+func (p *Patroni) RecentOperations() []TraceEntry {
+	if p.operations == nil {
+		return nil
+	}
+	walked := p.operations.Walk()
+	entries := make([]TraceEntry, 0, len(walked))
+	for _, entry := range walked {
+		entries = append(entries, entry.(TraceEntry))
+	}
+	return entries
+}
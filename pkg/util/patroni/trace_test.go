@@ -0,0 +1,138 @@
+package patroni
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/zalando/postgres-operator/mocks"
+)
+
+func TestTraceBodies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var testTable = []struct {
+		subtest  string
+		options  []Option
+		expected bool
+	}{
+		{
+			subtest:  "trace bodies disabled",
+			options:  nil,
+			expected: false,
+		},
+		{
+			subtest:  "trace bodies enabled",
+			options:  []Option{WithTraceBodies()},
+			expected: true,
+		},
+	}
+	for _, tt := range testTable {
+		logger, hook := test.NewNullLogger()
+		logger.SetLevel(logrus.TraceLevel)
+
+		mockClient := mocks.NewMockHTTPClient(ctrl)
+		mockClient.EXPECT().Do(gomock.Any()).Return(newMockResponse(http.StatusOK, `{"pause": true}`), nil)
+
+		p := New(logger.WithField("test", tt.subtest), mockClient, tt.options...)
+		err := p.SetConfig(context.Background(), newMockPod("192.168.100.1"), map[string]interface{}{"ttl": 20, "password": "secret"})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.subtest, err)
+		}
+
+		var traced []string
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == logrus.TraceLevel {
+				traced = append(traced, entry.Message)
+			}
+		}
+		if !tt.expected {
+			if len(traced) != 0 {
+				t.Errorf("%s: expected no traced bodies, got %v", tt.subtest, traced)
+			}
+			continue
+		}
+		if len(traced) != 2 {
+			t.Fatalf("%s: expected request and response bodies to be traced, got %v", tt.subtest, traced)
+		}
+		if !strings.Contains(traced[0], `"ttl":20`) || strings.Contains(traced[0], "secret") {
+			t.Errorf("%s: unexpected request body trace %q", tt.subtest, traced[0])
+		}
+		if !strings.Contains(traced[1], `"pause":true`) {
+			t.Errorf("%s: unexpected response body trace %q", tt.subtest, traced[1])
+		}
+	}
+}
+
+func TestMaxLoggedBodySize(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.TraceLevel)
+
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		return newMockResponse(http.StatusOK, `{"loop_wait": 10, "ttl": 30}`), nil
+	}}
+	p := New(logger.WithField("test", "truncate"), client, WithTraceBodies(), WithMaxLoggedBodySize(10))
+	if err := p.SetConfig(context.Background(), newMockPod("192.168.100.1"), map[string]interface{}{"postgresql": map[string]interface{}{"parameters": map[string]interface{}{"max_connections": "200"}}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var traced []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.TraceLevel {
+			traced = append(traced, entry.Message)
+		}
+	}
+	if len(traced) != 2 {
+		t.Fatalf("expected request and response bodies to be traced, got %v", traced)
+	}
+	for i, expected := range []string{`{"postgres...`, `{"loop_wai...`} {
+		if !strings.HasSuffix(traced[i], ": "+expected) {
+			t.Errorf("expected body truncated to %q, got %q", expected, traced[i])
+		}
+	}
+}
+
+func TestTraceBodiesNilLogger(t *testing.T) {
+	p := New(nil, nil, WithTraceBodies())
+	p.traceBody("request", http.MethodGet, "http://127.0.0.1:8008", []byte("{}"))
+}
+
+func TestRecentOperations(t *testing.T) {
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		if request.URL.Path == configPath {
+			return newMockResponse(http.StatusServiceUnavailable, "unavailable"), nil
+		}
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+	}}
+	p := New(testLogger, client, WithTraceBuffer(2))
+
+	if operations := New(nil, client).RecentOperations(); operations != nil {
+		t.Errorf("expected no operations without trace buffer, got %v", operations)
+	}
+
+	pod := newMockPod("192.168.100.1")
+	for i := 0; i < 3; i++ {
+		if _, err := p.GetStatus(context.Background(), pod); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := p.GetConfig(context.Background(), pod); err == nil {
+		t.Fatalf("expected an error for an unavailable config")
+	}
+
+	operations := p.RecentOperations()
+	if len(operations) != 2 {
+		t.Fatalf("expected the buffer to keep 2 operations, got %v", operations)
+	}
+	if op := operations[0]; op.Operation != "GET /patroni" || op.Status != http.StatusOK || op.Error != "" || op.Host != "192.168.100.1:8008" {
+		t.Errorf("unexpected first operation %#v", op)
+	}
+	if op := operations[1]; op.Operation != "GET /config" || op.Status != http.StatusServiceUnavailable || op.Error == "" {
+		t.Errorf("unexpected last operation %#v", op)
+	}
+}
@@ -0,0 +1,102 @@
+package patroni
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// defaultPollInterval between member data reads while waiting for a member
+// state
+const defaultPollInterval = 2 * time.Second
+
+// sleep waits for d or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// restartNow restarts the instance regardless of a pending restart
+func (p *Patroni) restartNow(ctx context.Context, server *v1.Pod) error {
+	return p.call(ctx, server, opRestart, bytes.NewBufferString("{}"))
+}
+
+// restartReplicaAndWait restarts a replica and waits until it runs again and
+// has replayed the WAL the leader had written before the restart
+func (p *Patroni) restartReplicaAndWait(ctx context.Context, server *v1.Pod, leader *v1.Pod, timeout time.Duration) error {
+	lsn, err := p.GetPrimaryLSN(ctx, leader)
+	if err != nil {
+		return err
+	}
+	if err := p.restartNow(ctx, server); err != nil {
+		return fmt.Errorf("could not restart %s: %v", server.Name, err)
+	}
+
+	deadline := p.clock.Now().Add(timeout)
+	for {
+		data, err := p.GetMemberData(ctx, server)
+		if err == nil && data.State == "running" && !data.IsLeader() && data.Xlog.ReplayedLocation >= lsn {
+			return nil
+		}
+		if p.clock.Now().After(deadline) {
+			return fmt.Errorf("%s did not rejoin as caught up replica within %v", server.Name, timeout)
+		}
+		if err := sleep(ctx, p.pollInterval); err != nil {
+			return fmt.Errorf("%s did not rejoin as caught up replica: %v", server.Name, err)
+		}
+	}
+}
+
+// RollingMinorUpgrade restarts all members after new binaries of a minor
+// version are in place. Replicas are restarted one at a time, each waiting
+// until it is a caught up replica again, then the leadership is switched over
+// to a replica and the old master restarted last. Any failure aborts the
+// sequence. The timeout applies to each step.
+func (p *Patroni) RollingMinorUpgrade(ctx context.Context, servers []*v1.Pod, master *v1.Pod, timeout time.Duration) error {
+	for _, server := range servers {
+		if server.Name == master.Name {
+			continue
+		}
+		if err := p.restartReplicaAndWait(ctx, server, master, timeout); err != nil {
+			return fmt.Errorf("could not upgrade replica: %v", err)
+		}
+	}
+
+	if len(servers) < 2 {
+		if err := p.restartNow(ctx, master); err != nil {
+			return fmt.Errorf("could not restart master %s: %v", master.Name, err)
+		}
+		return nil
+	}
+
+	members, _ := p.GetMembersData(ctx, servers)
+	candidate, err := ChooseSwitchoverCandidate(master, members)
+	if err != nil {
+		return err
+	}
+	if err := p.Switchover(ctx, master, candidate); err != nil {
+		return fmt.Errorf("could not switch over from %s to %s: %v", master.Name, candidate, err)
+	}
+	leader, err := p.WaitForNewLeader(ctx, servers, master.Name, timeout)
+	if err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		if server.Name == leader {
+			if err := p.restartReplicaAndWait(ctx, master, server, timeout); err != nil {
+				return fmt.Errorf("could not upgrade former master: %v", err)
+			}
+		}
+	}
+	return nil
+}
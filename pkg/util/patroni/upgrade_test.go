@@ -0,0 +1,87 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRollingMinorUpgrade(t *testing.T) {
+	var testTable = []struct {
+		subtest       string
+		failPost      string
+		expectedPosts []string
+		expectedError bool
+	}{
+		{
+			subtest: "all members restarted in order",
+			expectedPosts: []string{
+				"acid-test-1/restart",
+				"acid-test-2/restart",
+				"acid-test-0/failover",
+				"acid-test-0/restart",
+			},
+		},
+		{
+			subtest:  "failed replica restart aborts the sequence",
+			failPost: "acid-test-1",
+			expectedPosts: []string{
+				"acid-test-1/restart",
+			},
+			expectedError: true,
+		},
+	}
+	for _, tt := range testTable {
+		cluster := newFakeCluster()
+		cluster.failPosts[tt.failPost] = true
+		p := New(testLogger, cluster.client(), WithPollInterval(time.Millisecond))
+
+		err := p.RollingMinorUpgrade(context.Background(), cluster.pods, cluster.pod("acid-test-0"), time.Second)
+		if (err != nil) != tt.expectedError {
+			t.Errorf("%s: expected error %t, got %v", tt.subtest, tt.expectedError, err)
+		}
+		if !reflect.DeepEqual(cluster.posts, tt.expectedPosts) {
+			t.Errorf("%s: expected requests %v, got %v", tt.subtest, tt.expectedPosts, cluster.posts)
+		}
+	}
+}
+
+func TestRollingMinorUpgradeCancelled(t *testing.T) {
+	cluster := newFakeCluster()
+	// the switchover is accepted, but no new leader is elected
+	cluster.promote = false
+	p := New(testLogger, cluster.client(), WithPollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.RollingMinorUpgrade(ctx, cluster.pods, cluster.pod("acid-test-0"), time.Hour)
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrNoNewLeader) {
+			t.Errorf("expected %v, got %v", ErrNoNewLeader, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upgrade did not stop when the context was cancelled")
+	}
+}
+
+func TestRollingMinorUpgradeTimeout(t *testing.T) {
+	cluster := newFakeCluster()
+	// the replica does not come up again after its restart
+	cluster.members["acid-test-1"] = MemberData{State: "stopped", Role: "replica"}
+	clock := &fakeClock{now: time.Date(2021, 2, 19, 14, 0, 0, 0, time.UTC), step: time.Minute}
+	p := New(testLogger, cluster.client(), WithClock(clock), WithPollInterval(0))
+
+	err := p.RollingMinorUpgrade(context.Background(), cluster.pods, cluster.pod("acid-test-0"), time.Hour)
+	if err == nil {
+		t.Fatal("expected the upgrade to time out")
+	}
+	if expected := []string{"acid-test-1/restart"}; !reflect.DeepEqual(cluster.posts, expected) {
+		t.Errorf("expected requests %v, got %v", expected, cluster.posts)
+	}
+}
@@ -0,0 +1,17 @@
+package patroni
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// GetPendingWALArchive would return the number of WAL files waiting for
+// archival. Neither the status nor the metrics of Patroni report the state
+// of the archiver, so it always returns ErrNotSupported without querying the
+// member, the count has to be read from pg_stat_archiver or the archive
+// status directory instead.
+func (p *Patroni) GetPendingWALArchive(ctx context.Context, server *v1.Pod) (int, error) {
+	return 0, fmt.Errorf("could not get the pending WAL archive of %s: %w", server.Name, ErrNotSupported)
+}
@@ -0,0 +1,25 @@
+package patroni
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestGetPendingWALArchive(t *testing.T) {
+	var requests int
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		requests++
+		return newMockResponse(http.StatusOK, `{"state": "running", "role": "master"}`), nil
+	}}
+	p := New(testLogger, client)
+
+	pending, err := p.GetPendingWALArchive(context.Background(), newMockPod("192.168.100.1"))
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if pending != 0 || requests != 0 {
+		t.Errorf("expected no count and no request, got %d pending after %d requests", pending, requests)
+	}
+}
@@ -0,0 +1,78 @@
+package patroni
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// WatchOption configures WatchMemberData
+type WatchOption func(*pollSchedule)
+
+// pollSchedule decides the interval between two polls. Without adaptation the
+// interval stays fixed, otherwise it doubles with every poll without change
+// up to max and falls back to min once a change was seen.
+type pollSchedule struct {
+	interval time.Duration
+	adaptive bool
+	min      time.Duration
+	max      time.Duration
+}
+
+// WithAdaptiveInterval backs off polling while the member data is stable and
+// speeds up after a change, keeping the interval between min and max
+func WithAdaptiveInterval(min time.Duration, max time.Duration) WatchOption {
+	return func(s *pollSchedule) {
+		s.adaptive = true
+		s.min = min
+		s.max = max
+		s.interval = min
+	}
+}
+
+// next returns the interval to wait after a poll
+func (s *pollSchedule) next(changed bool) time.Duration {
+	if !s.adaptive {
+		return s.interval
+	}
+	if changed {
+		s.interval = s.min
+	} else if s.interval *= 2; s.interval > s.max {
+		s.interval = s.max
+	}
+	return s.interval
+}
+
+// WatchMemberData polls the member data every interval until the context is
+// done. onChange is called with the first result and afterwards whenever the
+// data differs from the previous poll or the poll fails.
+func (p *Patroni) WatchMemberData(ctx context.Context, server *v1.Pod, interval time.Duration, onChange func(MemberData, error), options ...WatchOption) error {
+	schedule := &pollSchedule{interval: interval}
+	for _, option := range options {
+		option(schedule)
+	}
+
+	var previous *MemberData
+	for {
+		data, err := p.GetMemberData(ctx, server)
+		// the latency differs with every poll and is no change of the member
+		data.APILatency = 0
+		changed := err != nil || previous == nil || !reflect.DeepEqual(data, *previous)
+		if changed {
+			onChange(data, err)
+		}
+		if err == nil {
+			previous = &data
+		}
+
+		timer := time.NewTimer(schedule.next(changed))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
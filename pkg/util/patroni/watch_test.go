@@ -0,0 +1,61 @@
+package patroni
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPollScheduleAdaptation(t *testing.T) {
+	fixed := &pollSchedule{interval: time.Second}
+	adaptive := &pollSchedule{}
+	WithAdaptiveInterval(time.Second, 5*time.Second)(adaptive)
+
+	changes := []bool{false, false, false, false, true, false, true}
+	expectedFixed := []time.Duration{1, 1, 1, 1, 1, 1, 1}
+	expectedAdaptive := []time.Duration{2, 4, 5, 5, 1, 2, 1}
+	for i, changed := range changes {
+		if interval := fixed.next(changed); interval != expectedFixed[i]*time.Second {
+			t.Errorf("poll %d: expected fixed interval %v, got %v", i, expectedFixed[i]*time.Second, interval)
+		}
+		if interval := adaptive.next(changed); interval != expectedAdaptive[i]*time.Second {
+			t.Errorf("poll %d: expected adaptive interval %v, got %v", i, expectedAdaptive[i]*time.Second, interval)
+		}
+	}
+}
+
+func TestWatchMemberData(t *testing.T) {
+	states := []string{"starting", "starting", "running", "running"}
+	var polls int
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &stubHTTPClient{handler: func(request *http.Request) (*http.Response, error) {
+		state := states[len(states)-1]
+		if polls < len(states) {
+			state = states[polls]
+		} else {
+			cancel()
+		}
+		polls++
+		return newMockResponse(http.StatusOK, `{"role": "replica", "state": "`+state+`"}`), nil
+	}}
+	p := New(nil, client)
+
+	var seen []string
+	err := p.WatchMemberData(ctx, newMockPod("192.168.100.1"), time.Millisecond, func(data MemberData, err error) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		seen = append(seen, data.State)
+	}, WithAdaptiveInterval(time.Millisecond, 4*time.Millisecond))
+
+	if err != context.Canceled {
+		t.Errorf("expected watch to end with the context, got %v", err)
+	}
+	if expected := []string{"starting", "running"}; !reflect.DeepEqual(seen, expected) {
+		t.Errorf("expected changes %v, got %v", expected, seen)
+	}
+}